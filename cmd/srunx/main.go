@@ -16,8 +16,8 @@
 
 package main
 
-import "fmt"
+import "CraneFrontEnd/internal/srunx"
 
 func main() {
-	fmt.Println("Hello world!")
+	srunx.ParseCmdArgs()
 }
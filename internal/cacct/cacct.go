@@ -36,7 +36,7 @@ var (
 )
 
 const (
-	kCraneExitCodeBase = 256
+	kCraneExitCodeBase = util.CraneExitCodeBase
 )
 
 // QueryJob will query all pending, running and completed tasks
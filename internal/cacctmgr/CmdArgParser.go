@@ -24,6 +24,7 @@ import (
 	"github.com/spf13/cobra"
 	"math"
 	"os"
+	"strconv"
 	"strings"
 )
 
@@ -46,6 +47,8 @@ var (
 	FlagAccount protos.AccountInfo
 	FlagUser    protos.UserInfo
 	FlagQos     protos.QosInfo
+	// Parsed into FlagQos.MaxTimeLimitPerTask
+	FlagMaxTimeLimitPerTask string
 
 	FlagConfigFilePath string
 
@@ -86,6 +89,7 @@ var (
 		Short: "Add a new qos",
 		Long:  "",
 		Run: func(cmd *cobra.Command, args []string) {
+			FlagQos.MaxTimeLimitPerTask = parseMaxTimeLimitPerTask()
 			AddQos(&FlagQos)
 		},
 	}
@@ -223,7 +227,7 @@ var (
 				ModifyQos("max_cpus_per_user", fmt.Sprint(FlagQos.MaxCpusPerUser), FlagName)
 			}
 			if cmd.Flags().Changed("max_time_limit_per_task") {
-				ModifyQos("max_time_limit_per_task", fmt.Sprint(FlagQos.MaxTimeLimitPerTask), FlagName)
+				ModifyQos("max_time_limit_per_task", fmt.Sprint(parseMaxTimeLimitPerTask()), FlagName)
 			}
 		},
 	}
@@ -390,7 +394,8 @@ func init() {
 	addQosCmd.Flags().Uint32VarP(&FlagQos.Priority, "priority", "P", 0, "")
 	addQosCmd.Flags().Uint32VarP(&FlagQos.MaxJobsPerUser, "max_jobs_per_user", "J", math.MaxUint32, "")
 	addQosCmd.Flags().Uint32VarP(&FlagQos.MaxCpusPerUser, "max_cpus_per_user", "c", math.MaxUint32, "")
-	addQosCmd.Flags().Uint64VarP(&FlagQos.MaxTimeLimitPerTask, "max_time_limit_per_task", "T", uint64(util.InvalidDuration().Seconds), "time in seconds")
+	addQosCmd.Flags().StringVarP(&FlagMaxTimeLimitPerTask, "max_time_limit_per_task", "T", "unlimited",
+		"time limit, in seconds if a bare number, e.g. 3600, 1-00:00:00, 90:00 or unlimited")
 	err = addQosCmd.MarkFlagRequired("name")
 	if err != nil {
 		return
@@ -454,7 +459,8 @@ func init() {
 	modifyQosCmd.Flags().Uint32VarP(&FlagQos.Priority, "priority", "P", 0, "")
 	modifyQosCmd.Flags().Uint32VarP(&FlagQos.MaxJobsPerUser, "max_jobs_per_user", "J", math.MaxUint32, "")
 	modifyQosCmd.Flags().Uint32VarP(&FlagQos.MaxCpusPerUser, "max_cpus_per_user", "c", math.MaxUint32, "")
-	modifyQosCmd.Flags().Uint64VarP(&FlagQos.MaxTimeLimitPerTask, "max_time_limit_per_task", "T", uint64(util.InvalidDuration().Seconds), "time in seconds")
+	modifyQosCmd.Flags().StringVarP(&FlagMaxTimeLimitPerTask, "max_time_limit_per_task", "T", "unlimited",
+		"time limit, in seconds if a bare number, e.g. 3600, 1-00:00:00, 90:00 or unlimited")
 	/* ---------------------------------------------------- show ---------------------------------------------------- */
 	rootCmd.AddCommand(showCmd)
 	showCmd.AddCommand(showAccountCmd)
@@ -488,3 +494,17 @@ func init() {
 		return
 	}
 }
+
+// parseMaxTimeLimitPerTask returns --max_time_limit_per_task in seconds.
+// Unlike the time limit of a job, a bare number is in seconds as it was
+// before the Slurm style forms were accepted.
+func parseMaxTimeLimitPerTask() uint64 {
+	if seconds, err := strconv.ParseUint(FlagMaxTimeLimitPerTask, 10, 64); err == nil {
+		return seconds
+	}
+	seconds, err := util.ParseDurationSeconds(FlagMaxTimeLimitPerTask)
+	if err != nil {
+		log.Fatalf("Invalid --max_time_limit_per_task: %s", err)
+	}
+	return uint64(seconds)
+}
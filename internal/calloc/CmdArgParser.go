@@ -22,16 +22,9 @@ import (
 )
 
 var (
-	FlagNodes         uint32
-	FlagCpuPerTask    float64
-	FlagNtasksPerNode uint32
-	FlagTime          string
-	FlagMem           string
-	FlagPartition     string
-	FlagJob           string
-	FlagAccount       string
-	FlagQos           string
-	FlagCwd           string
+	FlagResources   util.ResourceFlags
+	FlagImmediate   uint32
+	FlagWaitTimeout string
 
 	FlagConfigFilePath string
 	FlagDebugLevel     string
@@ -39,26 +32,31 @@ var (
 
 func CmdArgParser() *cobra.Command {
 	parser := &cobra.Command{
-		Use:   "calloc",
+		Use:   "calloc [flags] [-- command [args...]]",
 		Short: "allocate resource and create terminal",
+		Long: "Allocate resource and run an interactive shell in it, or the command if one is given. " +
+			"The allocation is released when the shell or the command exits, " +
+			"and calloc exits with the exit code of the command.",
 		Run: func(cmd *cobra.Command, args []string) {
 			main(cmd, args)
 		},
 	}
+	// The options after the command belong to the command.
+	parser.Flags().SetInterspersed(false)
 
 	parser.PersistentFlags().StringVarP(&FlagConfigFilePath, "config", "C", util.DefaultConfigPath, "Path to configuration file")
 	parser.PersistentFlags().StringVarP(&FlagDebugLevel, "debug-level", "D",
 		"info", "Output level")
-	parser.Flags().Uint32VarP(&FlagNodes, "nodes", "N", 1, " number of nodes on which to run (N = min[-max])")
-	parser.Flags().Float64VarP(&FlagCpuPerTask, "cpus-per-task", "c", 1, "number of cpus required per task")
-	parser.Flags().Uint32Var(&FlagNtasksPerNode, "ntasks-per-node", 1, "number of tasks to invoke on each node")
-	parser.Flags().StringVarP(&FlagTime, "time", "t", "", "time limit")
-	parser.Flags().StringVar(&FlagMem, "mem", "", "minimum amount of real memory")
-	parser.Flags().StringVarP(&FlagPartition, "partition", "p", "", "partition requested")
-	parser.Flags().StringVarP(&FlagJob, "job-name", "J", "", "name of job")
-	parser.Flags().StringVarP(&FlagAccount, "account", "A", "", "account used by the task")
-	parser.Flags().StringVar(&FlagCwd, "chdir", "", "working directory of the task")
-	parser.Flags().StringVarP(&FlagQos, "qos", "q", "", "quality of service")
+	FlagResources.AddFlags(parser)
+	// The seconds are optional as in salloc, so they must be attached to the
+	// flag: in "--immediate 5", 5 is taken as the command to run.
+	parser.Flags().Uint32VarP(&FlagImmediate, "immediate", "I", 0,
+		"cancel the job if the resources are not allocated in the given seconds, "+
+			"which must be given as --immediate=N or -IN, 1 if not given")
+	parser.Flags().Lookup("immediate").NoOptDefVal = "1"
+	parser.Flags().StringVar(&FlagWaitTimeout, "wait-timeout", "",
+		"cancel the job if the resources are not allocated in the given time, e.g. 10:00")
+	parser.MarkFlagsMutuallyExclusive("immediate", "wait-timeout")
 
 	return parser
 }
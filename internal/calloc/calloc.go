@@ -20,6 +20,7 @@ import "C"
 import (
 	"CraneFrontEnd/generated/protos"
 	"CraneFrontEnd/internal/util"
+	"CraneFrontEnd/internal/util/hostlist"
 	"context"
 	"fmt"
 	log "github.com/sirupsen/logrus"
@@ -31,8 +32,14 @@ import (
 	"os/user"
 	"strconv"
 	"strings"
+	"time"
 )
 
+// AllocationEnvironAliases, if set, returns more variables to be added to
+// those of the allocation. The Slurm compatible salloc sets it to add the
+// SLURM_* aliases.
+var AllocationEnvironAliases func(env []string) []string
+
 type GlobalVariables struct {
 	user      *user.User
 	cwd       string
@@ -41,6 +48,10 @@ type GlobalVariables struct {
 	globalCtx       context.Context
 	globalCtxCancel context.CancelFunc
 
+	ctldStub protos.CraneCtldClient
+	// How long calloc waits for the allocation. 0 means forever.
+	waitTimeout time.Duration
+
 	connectionBroken bool
 }
 
@@ -81,7 +92,10 @@ func ReplyReceiveRoutine(stream protos.CraneForeD_CallocStreamClient,
 	}
 }
 
-func StartCallocStream(task *protos.TaskToCtld) {
+// StartCallocStream requests the allocation from cfored and runs the shell,
+// or the command if one is given, in it. The exit code of calloc is returned,
+// which is the one of the command, or 1 if no allocation was made.
+func StartCallocStream(task *protos.TaskToCtld, command []string) int {
 	var opts []grpc.DialOption
 	opts = append(opts, grpc.WithTransportCredentials(insecure.NewCredentials()))
 
@@ -105,9 +119,16 @@ func StartCallocStream(task *protos.TaskToCtld) {
 
 	var request *protos.StreamCallocRequest
 	var taskId uint32
+	var allocationEnv []string
 
-	terminalExitChannel := make(chan bool, 1)
+	terminalExitChannel := make(chan int, 1)
 	cancelRequestChannel := make(chan bool, 1)
+	exitCode := 1
+
+	_ = util.SaveTerminal()
+	defer util.RestoreTerminal()
+	terminateChannel := make(chan os.Signal, 1)
+	go HandleTerminationSignals(terminateChannel)
 
 	state := ConnectCfored
 
@@ -144,7 +165,30 @@ CallocStateMachineLoop:
 			state = ReqTaskId
 
 		case ReqTaskId:
-			item := <-replyChannel
+			var item ReplyReceiveItem
+			select {
+			case item = <-replyChannel:
+			case sig := <-terminateChannel:
+				// The task id is not known yet. Cfored completes the task
+				// once CraneCtld allocates it.
+				_, _ = fmt.Fprintf(os.Stderr, "Received %s. Cancelling the job...\n", sig)
+				request = &protos.StreamCallocRequest{
+					Type: protos.StreamCallocRequest_TASK_COMPLETION_REQUEST,
+					Payload: &protos.StreamCallocRequest_PayloadTaskCompleteReq{
+						PayloadTaskCompleteReq: &protos.StreamCallocRequest_TaskCompleteReq{
+							Status: protos.TaskStatus_Cancelled,
+						},
+					},
+				}
+				if err := stream.Send(request); err != nil {
+					log.Errorf("The connection to Cfored was broken: %s. "+
+						"Exiting...", err)
+					gVars.connectionBroken = true
+					break CallocStateMachineLoop
+				}
+				state = WaitAck
+				continue
+			}
 			cforedReply, err := item.reply, item.err
 
 			if err != nil {
@@ -175,7 +219,29 @@ CallocStateMachineLoop:
 			}
 
 		case WaitRes:
-			item := <-replyChannel
+			item, gaveUp := WaitResourceAllocation(taskId, gVars.waitTimeout,
+				replyChannel, terminateChannel)
+			if gaveUp {
+				request = &protos.StreamCallocRequest{
+					Type: protos.StreamCallocRequest_TASK_COMPLETION_REQUEST,
+					Payload: &protos.StreamCallocRequest_PayloadTaskCompleteReq{
+						PayloadTaskCompleteReq: &protos.StreamCallocRequest_TaskCompleteReq{
+							TaskId: taskId,
+							Status: protos.TaskStatus_Cancelled,
+						},
+					},
+				}
+
+				log.Debug("Sending TASK_COMPLETION_REQUEST with CANCELLED state...")
+				if err := stream.Send(request); err != nil {
+					log.Errorf("The connection to Cfored was broken: %s. "+
+						"Exiting...", err)
+					gVars.connectionBroken = true
+					break CallocStateMachineLoop
+				}
+				state = WaitAck
+				break
+			}
 			cforedReply, err := item.reply, item.err
 
 			if err != nil { // Failure Edge
@@ -190,6 +256,26 @@ CallocStateMachineLoop:
 				}
 			}
 
+			if cforedReply.Type == protos.StreamCforedReply_TASK_CANCEL_REQUEST {
+				_, _ = fmt.Fprintf(os.Stderr, "Job #%d was cancelled while pending.\n", taskId)
+				request = &protos.StreamCallocRequest{
+					Type: protos.StreamCallocRequest_TASK_COMPLETION_REQUEST,
+					Payload: &protos.StreamCallocRequest_PayloadTaskCompleteReq{
+						PayloadTaskCompleteReq: &protos.StreamCallocRequest_TaskCompleteReq{
+							TaskId: taskId,
+							Status: protos.TaskStatus_Cancelled,
+						},
+					},
+				}
+				if err := stream.Send(request); err != nil {
+					log.Errorf("The connection to Cfored was broken: %s. "+
+						"Exiting...", err)
+					gVars.connectionBroken = true
+					break CallocStateMachineLoop
+				}
+				state = WaitAck
+				break
+			}
 			if cforedReply.Type != protos.StreamCforedReply_TASK_RES_ALLOC_REPLY {
 				log.Fatal("Expect TASK_RES_ALLOC_REPLY")
 			}
@@ -198,6 +284,10 @@ CallocStateMachineLoop:
 
 			if Ok {
 				fmt.Printf("Allocated craned nodes: %s\n", cforedPayload.AllocatedCranedRegex)
+				allocationEnv = AllocationEnviron(task, taskId, cforedPayload.AllocatedCranedRegex)
+				if AllocationEnvironAliases != nil {
+					allocationEnv = append(allocationEnv, AllocationEnvironAliases(allocationEnv)...)
+				}
 				state = TaskRunning
 			} else {
 				fmt.Println("Failed to allocate task resource. Exiting...")
@@ -205,21 +295,28 @@ CallocStateMachineLoop:
 			}
 
 		case TaskRunning:
-			go StartTerminal(gVars.shellPath, cancelRequestChannel, terminalExitChannel)
+			go StartTerminal(gVars.shellPath, command, allocationEnv,
+				cancelRequestChannel, terminalExitChannel)
 
 			select {
-			case <-terminalExitChannel:
+			case exitCode = <-terminalExitChannel:
+				// The exit code of an interactive shell is the one of the
+				// last command typed, so it doesn't tell if the job failed.
+				status := protos.TaskStatus_Completed
+				if len(command) > 0 && exitCode != 0 {
+					status = protos.TaskStatus_Failed
+				}
 				request = &protos.StreamCallocRequest{
 					Type: protos.StreamCallocRequest_TASK_COMPLETION_REQUEST,
 					Payload: &protos.StreamCallocRequest_PayloadTaskCompleteReq{
 						PayloadTaskCompleteReq: &protos.StreamCallocRequest_TaskCompleteReq{
 							TaskId: taskId,
-							Status: protos.TaskStatus_Completed,
+							Status: status,
 						},
 					},
 				}
 
-				log.Debug("Sending TASK_COMPLETION_REQUEST with COMPLETED state...")
+				log.Debugf("Sending TASK_COMPLETION_REQUEST with %s state...", status)
 				if err := stream.Send(request); err != nil {
 					log.Errorf("The connection to Cfored was broken: %s. "+
 						"Exiting...", err)
@@ -229,6 +326,10 @@ CallocStateMachineLoop:
 					state = WaitAck
 				}
 
+			case sig := <-terminateChannel:
+				_, _ = fmt.Fprintf(os.Stderr, "Received %s. Hanging up the shell...\n", sig)
+				state = TaskKilling
+
 			case item := <-replyChannel:
 				cforedReply, err := item.reply, item.err
 				if err != nil {
@@ -255,7 +356,7 @@ CallocStateMachineLoop:
 		case TaskKilling:
 			cancelRequestChannel <- true
 
-			<-terminalExitChannel
+			exitCode = <-terminalExitChannel
 			request = &protos.StreamCallocRequest{
 				Type: protos.StreamCallocRequest_TASK_COMPLETION_REQUEST,
 				Payload: &protos.StreamCallocRequest_PayloadTaskCompleteReq{
@@ -281,7 +382,15 @@ CallocStateMachineLoop:
 			}
 
 		case WaitAck:
-			item := <-replyChannel
+			var item ReplyReceiveItem
+			select {
+			case item = <-replyChannel:
+			case sig := <-terminateChannel:
+				// The job is being completed. Another signal exits at once.
+				_, _ = fmt.Fprintf(os.Stderr, "Received %s. "+
+					"Waiting for the job to be completed...\n", sig)
+				continue
+			}
 			cforedReply, err := item.reply, item.err
 
 			if err != nil {
@@ -296,8 +405,21 @@ CallocStateMachineLoop:
 				}
 			}
 
+			// The task id, the allocation or the cancellation of a pending
+			// job may cross with its completion request.
+			if cforedReply.Type == protos.StreamCforedReply_TASK_ID_REPLY &&
+				!cforedReply.GetPayloadTaskIdReply().Ok {
+				// No job was created, so there is nothing to complete.
+				break CallocStateMachineLoop
+			}
+			if cforedReply.Type == protos.StreamCforedReply_TASK_ID_REPLY ||
+				cforedReply.Type == protos.StreamCforedReply_TASK_RES_ALLOC_REPLY ||
+				cforedReply.Type == protos.StreamCforedReply_TASK_CANCEL_REQUEST {
+				log.Debugf("Ignored %s while waiting for TASK_COMPLETION_ACK_REPLY", cforedReply.Type)
+				break
+			}
 			if cforedReply.Type != protos.StreamCforedReply_TASK_COMPLETION_ACK_REPLY {
-				log.Fatal("Expect TASK_COMPLETION_ACK_REPLY. Received: %s", cforedReply.Type.String())
+				log.Fatalf("Expect TASK_COMPLETION_ACK_REPLY. Received: %s", cforedReply.Type.String())
 			}
 
 			if cforedReply.GetPayloadTaskCompletionAckReply().Ok {
@@ -309,9 +431,45 @@ CallocStateMachineLoop:
 			break CallocStateMachineLoop
 		}
 	}
+
+	return exitCode
+}
+
+// AllocationEnviron returns the variables which tell the shell and the
+// commands run in it, e.g. srunx, which job they belong to.
+func AllocationEnviron(task *protos.TaskToCtld, taskId uint32, cranedRegex string) []string {
+	numNodes := task.NodeNum
+	if cranedNames, err := hostlist.Expand(cranedRegex); err == nil {
+		numNodes = uint32(len(cranedNames))
+	} else {
+		log.Warnf("Invalid node list of the allocation %s: %s", cranedRegex, err)
+	}
+
+	env := []string{
+		fmt.Sprintf("CRANE_JOB_ID=%d", taskId),
+		fmt.Sprintf("CRANE_JOB_NODELIST=%s", cranedRegex),
+		fmt.Sprintf("CRANE_JOB_NUM_NODES=%d", numNodes),
+		fmt.Sprintf("CRANE_CPUS_PER_TASK=%s", strconv.FormatFloat(task.CpusPerTask, 'f', -1, 64)),
+		fmt.Sprintf("CRANE_NTASKS_PER_NODE=%d", task.NtasksPerNode),
+	}
+	// The default partition and account are chosen by CraneCtld
+	// if they are not given.
+	if task.PartitionName != "" {
+		env = append(env, "CRANE_JOB_PARTITION="+task.PartitionName)
+	}
+	if task.Account != "" {
+		env = append(env, "CRANE_JOB_ACCOUNT="+task.Account)
+	}
+	return env
 }
 
 func main(cmd *cobra.Command, args []string) {
+	if layers, err := util.LoadSubmitDefaults("calloc"); err != nil {
+		log.Fatalf("Failed to load the defaults: %s", err)
+	} else if err := FlagResources.ApplyDefaults(layers); err != nil {
+		log.Fatalf("Failed to load the defaults: %s", err)
+	}
+
 	var err error
 
 	switch FlagDebugLevel {
@@ -347,73 +505,43 @@ func main(cmd *cobra.Command, args []string) {
 			gVars.user.Name, err.Error())
 	}
 
-	task := &protos.TaskToCtld{
-		Name:          "Interactive",
-		TimeLimit:     util.InvalidDuration(),
-		PartitionName: "CPU",
-		Resources: &protos.Resources{
-			AllocatableResource: &protos.AllocatableResource{
-				CpuCoreLimit:       1,
-				MemoryLimitBytes:   1024 * 1024 * 128,
-				MemorySwLimitBytes: 1024 * 1024 * 128,
-			},
-		},
-		Type:            protos.TaskType_Interactive,
-		Uid:             uint32(uid),
-		NodeNum:         1,
-		NtasksPerNode:   1,
-		CpusPerTask:     1,
-		RequeueIfFailed: false,
-		Payload:         &protos.TaskToCtld_InteractiveMeta{InteractiveMeta: nil},
-		CmdLine:         strings.Join(os.Args, " "),
-		Cwd:             gVars.cwd,
-
-		// Todo: Propagate Env here!
-		Env: make(map[string]string),
-	}
+	task := util.NewTaskToCtld()
+	task.Name = "Interactive"
+	task.Type = protos.TaskType_Interactive
+	task.Uid = uint32(uid)
+	task.Payload = &protos.TaskToCtld_InteractiveMeta{InteractiveMeta: nil}
+	task.CmdLine = strings.Join(os.Args, " ")
+	task.Cwd = gVars.cwd
 
-	if FlagNodes != 0 {
-		task.NodeNum = FlagNodes
-	}
-	if FlagCpuPerTask != 0 {
-		task.CpusPerTask = FlagCpuPerTask
+	if err := FlagResources.Apply(task); err != nil {
+		log.Fatal(err)
 	}
-	if FlagNtasksPerNode != 0 {
-		task.NtasksPerNode = FlagNtasksPerNode
+	if err := util.CheckResources(task); err != nil {
+		log.Fatal(err)
 	}
-	if FlagTime != "" {
-		ok := util.ParseDuration(FlagTime, task.TimeLimit)
-		if !ok {
-			log.Fatalf("Invalid --time format.")
-		}
-	}
-	if FlagMem != "" {
-		memInByte, err := util.ParseMemStringAsByte(FlagMem)
+
+	if FlagImmediate != 0 {
+		gVars.waitTimeout = time.Duration(FlagImmediate) * time.Second
+	} else if FlagWaitTimeout != "" {
+		seconds, err := util.ParseDurationSeconds(FlagWaitTimeout)
 		if err != nil {
-			log.Fatal(err)
+			log.Fatalf("Invalid --wait-timeout: %s", err)
+		}
+		// "unlimited" means to wait forever as without --wait-timeout.
+		if seconds != util.InvalidDuration().Seconds {
+			gVars.waitTimeout = time.Duration(seconds) * time.Second
 		}
-		task.Resources.AllocatableResource.MemoryLimitBytes = memInByte
-		task.Resources.AllocatableResource.MemorySwLimitBytes = memInByte
-	}
-	if FlagPartition != "" {
-		task.PartitionName = FlagPartition
-	}
-	if FlagJob != "" {
-		task.Name = FlagJob
-	}
-	if FlagQos != "" {
-		task.Qos = FlagQos
-	}
-	if FlagCwd != "" {
-		task.Cwd = FlagCwd
-	}
-	if FlagAccount != "" {
-		task.Account = FlagAccount
 	}
 
-	if task.CpusPerTask <= 0 || task.NtasksPerNode == 0 || task.NodeNum == 0 {
-		log.Fatal("Invalid --cpus-per-task, --ntasks-per-node or --node-num")
+	// Process the content of --get-user-env
+	util.SetPropagatedEnviron(task)
+
+	config := util.ParseConfig(FlagConfigFilePath)
+	gVars.ctldStub = util.GetStubToCtldByConfig(config)
+	if task, err = util.RunSubmitFilters(config, "calloc", task); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Job rejected: %s\n", err)
+		os.Exit(1)
 	}
 
-	StartCallocStream(task)
+	os.Exit(StartCallocStream(task, args))
 }
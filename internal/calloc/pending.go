@@ -0,0 +1,162 @@
+/**
+ * Copyright (c) 2023 Peking University and Peking University
+ * Changsha Institute for Computing and Digital Economy
+ *
+ * CraneSched is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of
+ * the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS,
+ * WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+package calloc
+
+import (
+	"CraneFrontEnd/generated/protos"
+	"context"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+	"os"
+	"time"
+)
+
+// PendingStatusPollInterval is how often calloc queries CraneCtld for
+// the queue position and the priority of the pending job.
+const PendingStatusPollInterval = 5 * time.Second
+
+// queryPendingStatus describes the position of the pending job in the
+// queue of its partition and its priority.
+func queryPendingStatus(stub protos.CraneCtldClient, taskId uint32) (string, error) {
+	reply, err := stub.QueryTasksInfo(context.Background(), &protos.QueryTasksInfoRequest{
+		FilterTaskIds: []uint32{taskId},
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(reply.TaskInfoList) == 0 {
+		return "", fmt.Errorf("job %d is not found", taskId)
+	}
+	self := reply.TaskInfoList[0]
+
+	reply, err = stub.QueryTasksInfo(context.Background(), &protos.QueryTasksInfoRequest{
+		FilterPartitions: []string{self.Partition},
+		FilterTaskStates: []protos.TaskStatus{protos.TaskStatus_Pending},
+	})
+	if err != nil {
+		return "", err
+	}
+	// Jobs of the same priority are scheduled in the order of submission.
+	position := 1
+	for _, taskInfo := range reply.TaskInfoList {
+		if taskInfo.Priority > self.Priority ||
+			(taskInfo.Priority == self.Priority && taskInfo.TaskId < taskId) {
+			position++
+		}
+	}
+
+	return fmt.Sprintf("position %d in partition %s, priority %d",
+		position, self.Partition, self.Priority), nil
+}
+
+// pollPendingStatus sends the status of the pending job to statusChannel
+// periodically until ctx is done.
+func pollPendingStatus(ctx context.Context, taskId uint32, statusChannel chan string) {
+	ticker := time.NewTicker(PendingStatusPollInterval)
+	defer ticker.Stop()
+	for {
+		status, err := queryPendingStatus(gVars.ctldStub, taskId)
+		if err != nil {
+			log.Debugf("Failed to query the status of pending job #%d: %s", taskId, err)
+		} else {
+			select {
+			case statusChannel <- status:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func isTerminal(file *os.File) bool {
+	_, err := unix.IoctlGetTermios(int(file.Fd()), unix.TCGETS)
+	return err == nil
+}
+
+// WaitResourceAllocation waits for the reply of cfored to the resource
+// request while showing how long the job has been pending. It gives up
+// when calloc is signalled, e.g. by Ctrl-C, or the time given by --immediate
+// or --wait-timeout passes, in which case gaveUp is true.
+func WaitResourceAllocation(taskId uint32, timeout time.Duration,
+	replyChannel chan ReplyReceiveItem, terminateChannel chan os.Signal) (item ReplyReceiveItem, gaveUp bool) {
+	ctx, cancel := context.WithCancel(gVars.globalCtx)
+	defer cancel()
+
+	showStatus := isTerminal(os.Stderr)
+	statusChannel := make(chan string, 1)
+	if showStatus {
+		go pollPendingStatus(ctx, taskId, statusChannel)
+	}
+
+	var deadline <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	redrawTicker := time.NewTicker(time.Second)
+	defer redrawTicker.Stop()
+
+	begin := time.Now()
+	status := ""
+	timedOut := false
+	for {
+		if showStatus {
+			elapsed := time.Since(begin).Truncate(time.Second)
+			line := fmt.Sprintf("Pending for %s", elapsed)
+			if status != "" {
+				line += ", " + status
+			}
+			// Return to the beginning of the line and clear it.
+			_, _ = fmt.Fprintf(os.Stderr, "\r\033[K%s", line)
+		}
+
+		select {
+		case item = <-replyChannel:
+		case status = <-statusChannel:
+			continue
+		case <-redrawTicker.C:
+			continue
+		case <-deadline:
+			gaveUp = true
+			timedOut = true
+		case <-terminateChannel:
+			gaveUp = true
+		}
+		break
+	}
+
+	if showStatus {
+		_, _ = fmt.Fprint(os.Stderr, "\r\033[K")
+	}
+	if gaveUp {
+		if timedOut {
+			_, _ = fmt.Fprintf(os.Stderr, "Resources are not allocated in %s. Cancelling job #%d...\n",
+				timeout, taskId)
+		} else {
+			_, _ = fmt.Fprintf(os.Stderr, "Cancelling pending job #%d...\n", taskId)
+		}
+	}
+	return item, gaveUp
+}
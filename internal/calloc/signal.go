@@ -0,0 +1,46 @@
+/**
+ * Copyright (c) 2023 Peking University and Peking University
+ * Changsha Institute for Computing and Digital Economy
+ *
+ * CraneSched is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of
+ * the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS,
+ * WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+package calloc
+
+import (
+	"CraneFrontEnd/internal/util"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// TerminationSignals make calloc cancel the job and exit.
+var TerminationSignals = []os.Signal{syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT}
+
+// HandleTerminationSignals sends the first termination signal to
+// terminateChannel, so that calloc cancels the job in whichever state it
+// is and tells cfored. Another signal makes calloc exit at once.
+func HandleTerminationSignals(terminateChannel chan os.Signal) {
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, TerminationSignals...)
+
+	sig := <-sigs
+	log.Debugf("Received %s. Cancelling the job...", sig)
+	terminateChannel <- sig
+
+	sig = <-sigs
+	_, _ = fmt.Fprintf(os.Stderr, "Received %s again. "+
+		"Exiting without waiting for the job to be cancelled.\n", sig)
+	util.RestoreTerminal()
+	os.Exit(128 + int(sig.(syscall.Signal)))
+}
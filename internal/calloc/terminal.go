@@ -18,7 +18,6 @@ package calloc
 
 import (
 	"CraneFrontEnd/internal/util"
-	"github.com/pkg/term/termios"
 	log "github.com/sirupsen/logrus"
 	"golang.org/x/sys/unix"
 	"os"
@@ -28,35 +27,46 @@ import (
 	"syscall"
 )
 
-func StartTerminal(shellPath string,
+// StartTerminal runs the interactive shell, or the command if one is
+// given, in the foreground and sends its exit code to terminalExitChannel
+// once it exits. A command may also run without a terminal, e.g. in a script.
+// The variables in allocationEnv are added to the environment of calloc.
+func StartTerminal(shellPath string, command []string, allocationEnv []string,
 	cancelRequestChannel chan bool,
-	terminalExitChannel chan bool) {
+	terminalExitChannel chan int) {
 
 	callocPid := unix.Getpid()
 
 	pgrp := syscall.Getpgrp()
 	log.Tracef("Pgrp: %d", pgrp)
 
-	ptyAttr := unix.Termios{}
-	err := termios.Tcgetattr(os.Stdin.Fd(), &ptyAttr)
-	if err != nil {
+	err := util.SaveTerminal()
+	hasTerminal := err == nil
+	if !hasTerminal && len(command) == 0 {
 		log.Fatalf("tcgetattr: %v", err)
 		return
 	}
 
 	log.Tracef("IsForeGround: %v", util.IsForeground())
 
-	err = unix.Setpgid(callocPid, callocPid)
-	if err != nil {
-		log.Fatal(err)
-	}
+	if hasTerminal {
+		err = unix.Setpgid(callocPid, callocPid)
+		if err != nil {
+			log.Fatal(err)
+		}
 
-	err = util.TcSetpgrp(0, callocPid)
-	if err != nil {
-		log.Fatal(err)
+		err = util.TcSetpgrp(0, callocPid)
+		if err != nil {
+			log.Fatal(err)
+		}
 	}
 
-	process := exec.Command(shellPath, "-i")
+	var process *exec.Cmd
+	if len(command) == 0 {
+		process = exec.Command(shellPath, "-i")
+	} else {
+		process = exec.Command(command[0], command[1:]...)
+	}
 	process.Stdin = os.Stdin
 	process.Stdout = os.Stdout
 	process.Stderr = os.Stderr
@@ -65,13 +75,20 @@ func StartTerminal(shellPath string,
 		Pgid:    0,
 
 		Ctty:       0,
-		Foreground: true,
+		Foreground: hasTerminal,
 	}
-	process.Env = os.Environ()
+	process.Env = append(os.Environ(), allocationEnv...)
 
 	err = process.Start()
 	if err != nil {
-		log.Fatalf("Failed to call process.Start(): %v", err)
+		if len(command) == 0 {
+			log.Fatalf("Failed to call process.Start(): %v", err)
+		}
+		// Exit like a shell does when the command can't be run, so that
+		// the allocation is still released.
+		log.Errorf("Failed to run %s: %v", command[0], err)
+		terminalExitChannel <- 127
+		return
 	}
 
 	log.Tracef("Proc.Pid: %d", process.Process.Pid)
@@ -86,7 +103,9 @@ func StartTerminal(shellPath string,
 	sigsListenerDone := make(chan bool, 1)
 	var sigsListenerWg sync.WaitGroup
 
-	signal.Notify(sigs, syscall.SIGHUP)
+	// The termination signals also make calloc cancel the job, but they are
+	// forwarded as well, so that the command can clean up before the hangup.
+	signal.Notify(sigs, append([]os.Signal{syscall.SIGHUP}, TerminationSignals...)...)
 	signal.Ignore(syscall.SIGTSTP, syscall.SIGTTIN, syscall.SIGTTOU)
 
 	sigsListenerWg.Add(1)
@@ -101,7 +120,7 @@ func StartTerminal(shellPath string,
 			case sig := <-sigs:
 				log.Tracef("Signal received: %v", sig)
 				switch sig {
-				case syscall.SIGHUP:
+				case syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT:
 					signalErr := process.Process.Signal(sig)
 					if signalErr != nil {
 						log.Trace(signalErr)
@@ -117,9 +136,11 @@ func StartTerminal(shellPath string,
 		log.Tracef("Signal processing goroutine exit.")
 	}(&sigsListenerWg)
 
-	err = util.TcSetpgrp(0, process.Process.Pid)
-	if err != nil {
-		log.Fatal(err)
+	if hasTerminal {
+		err = util.TcSetpgrp(0, process.Process.Pid)
+		if err != nil {
+			log.Fatal(err)
+		}
 	}
 
 	// Listen to cancel request
@@ -152,25 +173,30 @@ func StartTerminal(shellPath string,
 
 	// Restore calloc terminal
 
-	err = util.TcSetpgrp(0, callocPid)
-	if err != nil {
-		log.Fatal(err)
+	if hasTerminal {
+		err = util.TcSetpgrp(0, callocPid)
+		if err != nil {
+			log.Fatal(err)
+		}
 	}
 
+	exitCode := 0
 	if procWaitErr != nil {
 		log.Tracef("Failed to call process.Run(): %v", procWaitErr)
 		exitError, ok := procWaitErr.(*exec.ExitError)
 		if !ok {
-			log.Tracef("Failed to convert err returned by process.Run() to os.ExitError")
-		}
-
-		if exitError.Success() {
-			log.Tracef("Proc exited with code %d", exitError.ExitCode())
+			log.Errorf("Failed to wait for the process: %v", procWaitErr)
+			exitCode = 1
 		} else {
 			waitStatus := exitError.Sys().(syscall.WaitStatus)
-			log.Tracef("Proc was killed by signal: %t. "+
-				"Proc was stopped(SIGSTP): %t. Signal received: %s",
-				waitStatus.Signaled(), waitStatus.Stopped(), waitStatus.Signal().String())
+			if waitStatus.Signaled() {
+				log.Tracef("Proc was killed by signal: %s", waitStatus.Signal().String())
+				// The same as what a shell reports.
+				exitCode = 128 + int(waitStatus.Signal())
+			} else {
+				log.Tracef("Proc exited with code %d", waitStatus.ExitStatus())
+				exitCode = waitStatus.ExitStatus()
+			}
 		}
 	} else {
 		log.Tracef("Proc exited with code: 0")
@@ -181,12 +207,11 @@ func StartTerminal(shellPath string,
 
 	sigsListenerWg.Wait()
 	cancelListenerWg.Wait()
+	signal.Stop(sigs)
 
-	err = termios.Tcsetattr(os.Stdin.Fd(), termios.TCSANOW, &ptyAttr)
-	if err != nil {
-		log.Fatalf("tcsetattr: %v", err)
-		return
+	if hasTerminal {
+		util.RestoreTerminal()
 	}
 
-	terminalExitChannel <- true
+	terminalExitChannel <- exitCode
 }
@@ -23,56 +23,63 @@ import (
 )
 
 var (
-	FlagNodes         uint32
-	FlagCpuPerTask    float64
-	FlagNtasksPerNode uint32
-	FlagTime          string
-	FlagMem           string
-	FlagPartition     string
-	FlagJob           string
-	FlagAccount       string
-	FlagQos           string
-	FlagCwd           string
-	FlagRepeat        uint32
-	FlagNodelist      string
-	FlagExcludes      string
-	FlagGetUserEnv    string
-	FlagExport        string
-	FlagStdoutPath    string
-	FlagStderrPath    string
+	FlagResources  util.ResourceFlags
+	FlagRepeat     uint32
+	FlagStdoutPath string
+	FlagStderrPath string
+	FlagArray      string
+	FlagWait       bool
+	FlagWrap       string
+	FlagTestOnly   string
+	FlagLint       bool
+	FlagParsable   bool
+	FlagResubmit   uint32
+	FlagHistory    uint32
+
+	FlagTranslateDirectives bool
 
 	FlagConfigFilePath string
 )
 
 func ParseCmdArgs() {
 	rootCmd := &cobra.Command{
-		Use:   "cbatch",
+		Use:   "cbatch [flags] [file | -]",
 		Short: "submit batch jobs",
-		Args:  cobra.ExactArgs(1),
+		Long: "Submit a batch job. The job script is read from the file, " +
+			"or from stdin if the file is '-' or omitted with piped input.",
+		Args: cobra.MaximumNArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
-			Cbatch(args[0])
+			Cbatch(args)
 		},
 	}
 
 	rootCmd.PersistentFlags().StringVarP(&FlagConfigFilePath, "config", "C",
 		util.DefaultConfigPath, "Path to configuration file")
-	rootCmd.Flags().Uint32VarP(&FlagNodes, "nodes", "N", 0, " number of nodes on which to run (N = min[-max])")
-	rootCmd.Flags().Float64VarP(&FlagCpuPerTask, "cpus-per-task", "c", 0, "number of cpus required per task")
-	rootCmd.Flags().Uint32Var(&FlagNtasksPerNode, "ntasks-per-node", 0, "number of tasks to invoke on each node")
-	rootCmd.Flags().StringVarP(&FlagTime, "time", "t", "", "time limit")
-	rootCmd.Flags().StringVar(&FlagMem, "mem", "", "minimum amount of real memory")
-	rootCmd.Flags().StringVarP(&FlagPartition, "partition", "p", "", "partition requested")
-	rootCmd.Flags().StringVarP(&FlagJob, "job-name", "J", "", "name of job")
-	rootCmd.Flags().StringVarP(&FlagAccount, "account", "A", "", "account used by the task")
-	rootCmd.Flags().StringVar(&FlagCwd, "chdir", "", "working directory of the task")
-	rootCmd.Flags().StringVarP(&FlagQos, "qos", "q", "", "quality of service")
+	FlagResources.AddFlags(rootCmd)
 	rootCmd.Flags().Uint32Var(&FlagRepeat, "repeat", 1, "submit the task multiple times")
-	rootCmd.Flags().StringVarP(&FlagNodelist, "nodelist", "w", "", "List of specific nodes to be allocated to the job")
-	rootCmd.Flags().StringVarP(&FlagExcludes, "exclude", "x", "", "exclude a specific list of hosts")
-	rootCmd.Flags().StringVar(&FlagGetUserEnv, "get-user-env", "", "get user's environment variables")
-	rootCmd.Flags().StringVar(&FlagExport, "export", "", "propagate environment variables")
 	rootCmd.Flags().StringVarP(&FlagStdoutPath, "output", "o", "", "file for batch script's standard output")
 	rootCmd.Flags().StringVarP(&FlagStderrPath, "error", "e", "", "file for batch script's standard error output")
+	rootCmd.Flags().StringVar(&FlagWrap, "wrap", "", "wrap the command string in a /bin/sh script and submit it")
+	rootCmd.Flags().BoolVarP(&FlagWait, "wait", "W", false, "wait for the job to finish and exit with its exit code")
+	rootCmd.Flags().StringVarP(&FlagArray, "array", "a", "", "submit a job array, e.g. 1-100:2%10")
+
+	rootCmd.Flags().StringVar(&FlagTestOnly, "test-only", "",
+		"print the job to be submitted as yaml or json without submitting it")
+	rootCmd.Flags().Lookup("test-only").NoOptDefVal = "yaml"
+
+	rootCmd.Flags().BoolVar(&FlagLint, "lint", false,
+		"check the job script without submitting it. "+
+			"Exit with 0 if it is clean, 1 on errors and 2 on warnings only")
+
+	rootCmd.Flags().BoolVar(&FlagParsable, "parsable", false, "only print the job id after submission")
+	rootCmd.Flags().Uint32Var(&FlagResubmit, "resubmit", 0,
+		"submit a job recorded in the journal again. Options given on the command line override the recorded ones")
+	rootCmd.Flags().Uint32Var(&FlagHistory, "history", 0, "list the most recent submissions in the journal")
+	rootCmd.Flags().Lookup("history").NoOptDefVal = "20"
+	rootCmd.MarkFlagsMutuallyExclusive("resubmit", "history")
+
+	rootCmd.Flags().BoolVar(&FlagTranslateDirectives, "translate-directives", false,
+		"translate #SBATCH and #PBS directives in the job script")
 
 	if err := rootCmd.Execute(); err != nil {
 		os.Exit(1)
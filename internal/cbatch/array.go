@@ -0,0 +1,284 @@
+/**
+ * Copyright (c) 2023 Peking University and Peking University
+ * Changsha Institute for Computing and Digital Economy
+ *
+ * CraneSched is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of
+ * the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS,
+ * WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package cbatch
+
+import (
+	"CraneFrontEnd/generated/protos"
+	"CraneFrontEnd/internal/util"
+	"context"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/proto"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ArrayThrottlePollInterval is how often the throttled submitter checks
+// the number of array elements that are still pending or running.
+const ArrayThrottlePollInterval = 5 * time.Second
+
+// MaxArraySize bounds the number of elements of a job array, which are
+// all kept in memory and submitted one by one.
+const MaxArraySize = 10000
+
+// ArraySpec is the parsed value of --array, e.g. "1-100:2%10".
+type ArraySpec struct {
+	indices []uint32
+	// throttle is the max number of elements pending or running at the
+	// same time. 0 means unlimited.
+	throttle uint32
+}
+
+// ParseArraySpec parses an array specification of the form
+// "range[,range...][%throttle]", where each range is either "n" or "lo-hi[:step]".
+func ParseArraySpec(spec string) (*ArraySpec, error) {
+	result := new(ArraySpec)
+
+	rangesStr, throttleStr, hasThrottle := strings.Cut(spec, "%")
+	if hasThrottle {
+		throttle, err := strconv.ParseUint(throttleStr, 10, 32)
+		if err != nil || throttle == 0 {
+			return nil, fmt.Errorf("invalid throttle %s in array %s", throttleStr, spec)
+		}
+		result.throttle = uint32(throttle)
+	}
+
+	seen := make(map[uint32]bool)
+	for _, rangeStr := range strings.Split(rangesStr, ",") {
+		boundsStr, stepStr, hasStep := strings.Cut(rangeStr, ":")
+		loStr, hiStr, isRange := strings.Cut(boundsStr, "-")
+		if !isRange {
+			if hasStep {
+				return nil, fmt.Errorf("step without range in array %s", spec)
+			}
+			hiStr = loStr
+		}
+
+		lo, err := strconv.ParseUint(loStr, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid range %s in array %s", rangeStr, spec)
+		}
+		hi, err := strconv.ParseUint(hiStr, 10, 32)
+		if err != nil || hi < lo {
+			return nil, fmt.Errorf("invalid range %s in array %s", rangeStr, spec)
+		}
+		step := uint64(1)
+		if hasStep {
+			step, err = strconv.ParseUint(stepStr, 10, 32)
+			if err != nil || step == 0 {
+				return nil, fmt.Errorf("invalid step %s in array %s", stepStr, spec)
+			}
+		}
+
+		if uint64(len(result.indices))+(hi-lo)/step+1 > MaxArraySize {
+			return nil, fmt.Errorf("array %s has more than %d elements", spec, MaxArraySize)
+		}
+
+		for i := lo; i <= hi; i += step {
+			if !seen[uint32(i)] {
+				seen[uint32(i)] = true
+				result.indices = append(result.indices, uint32(i))
+			}
+		}
+	}
+
+	return result, nil
+}
+
+func (spec *ArraySpec) minMax() (uint32, uint32) {
+	minIdx, maxIdx := spec.indices[0], spec.indices[0]
+	for _, i := range spec.indices {
+		if i < minIdx {
+			minIdx = i
+		}
+		if i > maxIdx {
+			maxIdx = i
+		}
+	}
+	return minIdx, maxIdx
+}
+
+// ExpandArrayFilePattern replaces %A with the array job id and %a with
+// the array index in an output file pattern. "%%" is kept as it is for craned.
+func ExpandArrayFilePattern(pattern string, arrayJobId string, index uint32) string {
+	var builder strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] == '%' && i+1 < len(pattern) {
+			switch pattern[i+1] {
+			case 'A':
+				builder.WriteString(arrayJobId)
+				i++
+				continue
+			case 'a':
+				builder.WriteString(strconv.FormatUint(uint64(index), 10))
+				i++
+				continue
+			case '%':
+				builder.WriteString("%%")
+				i++
+				continue
+			}
+		}
+		builder.WriteByte(pattern[i])
+	}
+	return builder.String()
+}
+
+// buildArrayElement derives the task of one array element from the template.
+// The id of the array job is the id of its first element, which is not known
+// before the first submission. In that case %A falls back to %j and the script
+// exports CRANE_ARRAY_JOB_ID from CRANE_JOB_ID.
+func buildArrayElement(template *protos.TaskToCtld, spec *ArraySpec,
+	arrayJobId uint32, index uint32) *protos.TaskToCtld {
+	task := proto.Clone(template).(*protos.TaskToCtld)
+	if task.Env == nil {
+		task.Env = make(map[string]string)
+	}
+
+	minIdx, maxIdx := spec.minMax()
+	task.Env["CRANE_ARRAY_TASK_ID"] = strconv.FormatUint(uint64(index), 10)
+	task.Env["CRANE_ARRAY_TASK_MIN"] = strconv.FormatUint(uint64(minIdx), 10)
+	task.Env["CRANE_ARRAY_TASK_MAX"] = strconv.FormatUint(uint64(maxIdx), 10)
+	task.Env["CRANE_ARRAY_TASK_COUNT"] = strconv.Itoa(len(spec.indices))
+
+	arrayJobIdStr := "%j"
+	if arrayJobId != 0 {
+		arrayJobIdStr = strconv.FormatUint(uint64(arrayJobId), 10)
+		task.Env["CRANE_ARRAY_JOB_ID"] = arrayJobIdStr
+	} else {
+		task.GetBatchMeta().ShScript = InsertAfterShebang(task.GetBatchMeta().ShScript,
+			"export CRANE_ARRAY_JOB_ID=$CRANE_JOB_ID")
+	}
+
+	meta := task.GetBatchMeta()
+	meta.OutputFilePattern = ExpandArrayFilePattern(meta.OutputFilePattern, arrayJobIdStr, index)
+	meta.ErrorFilePattern = ExpandArrayFilePattern(meta.ErrorFilePattern, arrayJobIdStr, index)
+	if task.Name != "" {
+		task.Name = fmt.Sprintf("%s_%d", task.Name, index)
+	}
+
+	return task
+}
+
+// InsertAfterShebang inserts a line into the script right after
+// the interpreter line, or at the beginning if there is none.
+func InsertAfterShebang(script string, line string) string {
+	if strings.HasPrefix(script, "#!") {
+		first, rest, _ := strings.Cut(script, "\n")
+		return first + "\n" + line + "\n" + rest
+	}
+	return line + "\n" + script
+}
+
+func countActiveTasks(stub protos.CraneCtldClient, taskIds []uint32) (uint32, error) {
+	req := &protos.QueryTasksInfoRequest{
+		FilterTaskIds:    taskIds,
+		FilterTaskStates: []protos.TaskStatus{protos.TaskStatus_Pending, protos.TaskStatus_Running},
+	}
+	reply, err := stub.QueryTasksInfo(context.Background(), req)
+	if err != nil {
+		return 0, err
+	}
+	if !reply.GetOk() {
+		return 0, fmt.Errorf("failed to query the array elements")
+	}
+	return uint32(len(reply.TaskInfoList)), nil
+}
+
+// SendArrayRequests submits one task per array element. If the array
+// is throttled, cbatch keeps running until every element is submitted,
+// submitting a new element only when fewer than throttle elements are
+// pending or running. The ids of the submitted elements are returned,
+// together with an error if some elements failed to be submitted.
+func SendArrayRequests(template *protos.TaskToCtld, spec *ArraySpec) ([]uint32, error) {
+	config := util.ParseConfig(FlagConfigFilePath)
+	stub := util.GetStubToCtldByConfig(config)
+
+	if spec.throttle != 0 && spec.throttle < uint32(len(spec.indices)) {
+		_, _ = fmt.Fprintf(os.Stderr, "At most %d array elements will be pending or running at the same time. "+
+			"cbatch keeps running until all of %d elements are submitted.\n",
+			spec.throttle, len(spec.indices))
+	}
+
+	var arrayJobId uint32
+	var submitted []uint32
+	var failed int
+	for _, index := range spec.indices {
+		for spec.throttle != 0 && uint32(len(submitted)) >= spec.throttle {
+			active, err := countActiveTasks(stub, submitted)
+			if err != nil {
+				util.GrpcErrorPrintf(err, "Failed to query the array elements")
+			}
+			if active < spec.throttle {
+				break
+			}
+			time.Sleep(ArrayThrottlePollInterval)
+		}
+
+		task := buildArrayElement(template, spec, arrayJobId, index)
+		reply, err := stub.SubmitBatchTask(context.Background(), &protos.SubmitBatchTaskRequest{Task: task})
+		if err != nil {
+			util.GrpcErrorPrintf(err, "Failed to submit the array element %d", index)
+		}
+		if !reply.GetOk() {
+			failed++
+			fmt.Printf("Array element %d allocation failed: %s\n", index, reply.GetReason())
+			continue
+		}
+
+		if arrayJobId == 0 {
+			arrayJobId = reply.GetTaskId()
+		}
+		submitted = append(submitted, reply.GetTaskId())
+		log.Debugf("Array element %d submitted as task #%d", index, reply.GetTaskId())
+	}
+
+	if len(submitted) == 0 {
+		log.Fatal("No array element is submitted")
+	}
+	if FlagParsable {
+		fmt.Println(arrayJobId)
+	} else {
+		fmt.Printf("Array job %d submitted. Task Id allocated: %s\n",
+			arrayJobId, FormatTaskIdRange(submitted))
+	}
+	if failed > 0 {
+		return submitted, fmt.Errorf("%d array elements failed to be submitted", failed)
+	}
+	return submitted, nil
+}
+
+// FormatTaskIdRange formats a list of task ids, collapsing consecutive
+// ids into ranges, e.g. "10-15,17".
+func FormatTaskIdRange(taskIds []uint32) string {
+	var parts []string
+	for i := 0; i < len(taskIds); {
+		j := i
+		for j+1 < len(taskIds) && taskIds[j+1] == taskIds[j]+1 {
+			j++
+		}
+		if i == j {
+			parts = append(parts, strconv.FormatUint(uint64(taskIds[i]), 10))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d-%d", taskIds[i], taskIds[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,145 @@
+/**
+ * Copyright (c) 2023 Peking University and Peking University
+ * Changsha Institute for Computing and Digital Economy
+ *
+ * CraneSched is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of
+ * the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS,
+ * WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+package cbatch
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseArraySpec(t *testing.T) {
+	tests := []struct {
+		in           string
+		wantIndices  []uint32
+		wantThrottle uint32
+	}{
+		{"5", []uint32{5}, 0},
+		{"0-3", []uint32{0, 1, 2, 3}, 0},
+		{"1-10:3", []uint32{1, 4, 7, 10}, 0},
+		{"1-9:4", []uint32{1, 5, 9}, 0},
+		{"1,3,5-6", []uint32{1, 3, 5, 6}, 0},
+		{"1-3,2-4", []uint32{1, 2, 3, 4}, 0},
+		{"0-99%10", nil, 10},
+		{"4294967295", []uint32{4294967295}, 0},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseArraySpec(tt.in)
+		if err != nil {
+			t.Errorf("ParseArraySpec(%q) returned an error: %s", tt.in, err)
+			continue
+		}
+		if tt.wantIndices != nil && !reflect.DeepEqual(got.indices, tt.wantIndices) {
+			t.Errorf("ParseArraySpec(%q).indices = %v, want %v", tt.in, got.indices, tt.wantIndices)
+		}
+		if got.throttle != tt.wantThrottle {
+			t.Errorf("ParseArraySpec(%q).throttle = %d, want %d", tt.in, got.throttle, tt.wantThrottle)
+		}
+	}
+}
+
+func TestParseArraySpecInvalid(t *testing.T) {
+	tests := []struct {
+		in      string
+		wantErr string
+	}{
+		{"", "invalid range"},
+		{"a", "invalid range"},
+		{"3-1", "invalid range"},
+		{"1-", "invalid range"},
+		{"-1", "invalid range"},
+		{"1,,2", "invalid range"},
+		{"5:2", "step without range"},
+		{"1-5:0", "invalid step"},
+		{"1-5:x", "invalid step"},
+		{"1-5%0", "invalid throttle"},
+		{"1-5%", "invalid throttle"},
+		{"4294967296", "invalid range"},
+		{"0-10000", "more than 10000 elements"},
+		{"0-5000,6000-11000", "more than 10000 elements"},
+		{"0-4294967295", "more than 10000 elements"},
+	}
+
+	for _, tt := range tests {
+		_, err := ParseArraySpec(tt.in)
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("ParseArraySpec(%q) returned %v, want an error with %q", tt.in, err, tt.wantErr)
+		}
+	}
+}
+
+func TestExpandArrayFilePattern(t *testing.T) {
+	tests := []struct {
+		pattern    string
+		arrayJobId string
+		index      uint32
+		want       string
+	}{
+		{"out.txt", "100", 3, "out.txt"},
+		{"%A_%a.out", "100", 3, "100_3.out"},
+		{"%A_%a.out", "%j", 0, "%j_0.out"},
+		{"%j-%a", "100", 7, "%j-7"},
+		{"100%%_%a", "100", 1, "100%%_1"},
+		{"%%a", "100", 1, "%%a"},
+		{"end%", "100", 1, "end%"},
+		{"%x", "100", 1, "%x"},
+	}
+
+	for _, tt := range tests {
+		got := ExpandArrayFilePattern(tt.pattern, tt.arrayJobId, tt.index)
+		if got != tt.want {
+			t.Errorf("ExpandArrayFilePattern(%q, %q, %d) = %q, want %q",
+				tt.pattern, tt.arrayJobId, tt.index, got, tt.want)
+		}
+	}
+}
+
+func TestFormatTaskIdRange(t *testing.T) {
+	tests := []struct {
+		in   []uint32
+		want string
+	}{
+		{nil, ""},
+		{[]uint32{5}, "5"},
+		{[]uint32{1, 2, 3}, "1-3"},
+		{[]uint32{1, 3, 5}, "1,3,5"},
+		{[]uint32{1, 2, 4, 5, 6, 9}, "1-2,4-6,9"},
+	}
+
+	for _, tt := range tests {
+		if got := FormatTaskIdRange(tt.in); got != tt.want {
+			t.Errorf("FormatTaskIdRange(%v) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestInsertAfterShebang(t *testing.T) {
+	tests := []struct {
+		script string
+		want   string
+	}{
+		{"#!/bin/bash\nhostname\n", "#!/bin/bash\nexport A=1\nhostname\n"},
+		{"hostname\n", "export A=1\nhostname\n"},
+		{"#!/bin/sh", "#!/bin/sh\nexport A=1\n"},
+	}
+
+	for _, tt := range tests {
+		if got := InsertAfterShebang(tt.script, "export A=1"); got != tt.want {
+			t.Errorf("InsertAfterShebang(%q) = %q, want %q", tt.script, got, tt.want)
+		}
+	}
+}
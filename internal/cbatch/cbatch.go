@@ -23,157 +23,127 @@ import (
 	"context"
 	"fmt"
 	log "github.com/sirupsen/logrus"
+	"io"
 	"os"
-	"regexp"
 	"strconv"
 	"strings"
 )
 
+// SubmitMessageFormat is printed with the task id after the task is
+// submitted. The Slurm compatible sbatch replaces it with its own message.
+var SubmitMessageFormat = "Task Id allocated: %d\n"
+
 type CbatchArg struct {
 	name string
 	val  string
+
+	// Position of the directive in the job script. line is 0 if the
+	// directive comes from the defaults.
+	line   int
+	column int
+	// Prefix of the directive, e.g. #SBATCH if it is translated,
+	// or where the defaults come from
+	prefix string
+}
+
+// source describes where the directive comes from.
+func (a *CbatchArg) source() string {
+	prefix := a.prefix
+	if prefix == "" {
+		prefix = DirectivePrefix
+	}
+	if a.line == 0 {
+		return prefix
+	}
+	return fmt.Sprintf("%s line %d", prefix, a.line)
+}
+
+// directiveOption is an option accepted both on the command line and in
+// the directives, i.e. a resource option or one of batchOptions.
+type directiveOption struct {
+	name      string
+	shorthand string
+	// field of TaskToCtld set by the option, empty if there is none.
+	field string
+	// changed returns whether the option is given on the command line.
+	changed func() bool
+}
+
+// batchOptions are the options of the directives only known to cbatch.
+var batchOptions = []directiveOption{
+	{"output", "o", "batch_meta.output_file_pattern", func() bool { return FlagStdoutPath != "" }},
+	{"error", "e", "batch_meta.error_file_pattern", func() bool { return FlagStderrPath != "" }},
+	{"array", "a", "", func() bool { return FlagArray != "" }},
+}
+
+// directiveOptions returns all the options accepted in the directives.
+func directiveOptions() []directiveOption {
+	options := make([]directiveOption, 0, len(util.ResourceOptions)+len(batchOptions))
+	for _, opt := range util.ResourceOptions {
+		name := opt.Name
+		options = append(options, directiveOption{opt.Name, opt.Shorthand, opt.Field,
+			func() bool { return FlagResources.Changed(name) }})
+	}
+	return append(options, batchOptions...)
 }
 
-func ProcessCbatchArg(args []CbatchArg) (bool, *protos.TaskToCtld) {
-	task := new(protos.TaskToCtld)
-	task = new(protos.TaskToCtld)
-	task.TimeLimit = util.InvalidDuration()
-	task.Resources = &protos.Resources{
-		AllocatableResource: &protos.AllocatableResource{
-			CpuCoreLimit:       1,
-			MemoryLimitBytes:   0,
-			MemorySwLimitBytes: 0,
-		},
+// names returns how the option is written, e.g. --nodes and -N.
+func (o *directiveOption) names() []string {
+	if o.shorthand == "" {
+		return []string{"--" + o.name}
 	}
+	return []string{"--" + o.name, "-" + o.shorthand}
+}
+
+// ProcessCbatchArg builds the task from the directives and the command line.
+// The array specification is returned separately since it is not a part of
+// the task but tells how many tasks to submit.
+func ProcessCbatchArg(args []CbatchArg) (bool, *protos.TaskToCtld, string) {
+	array := FlagArray
+	task := util.NewTaskToCtld()
 	task.Payload = &protos.TaskToCtld_BatchMeta{
 		BatchMeta: &protos.BatchTaskAdditionalMeta{},
 	}
 
-	task.CpusPerTask = 1
-	task.NtasksPerNode = 1
-	task.NodeNum = 1
-	task.GetUserEnv = false
-	task.Env = make(map[string]string)
-
 	///*************set parameter values based on the file*******************************///
 	for _, arg := range args {
-		switch arg.name {
-		case "--nodes", "-N":
-			num, err := strconv.ParseUint(arg.val, 10, 32)
-			if err != nil {
-				log.Print("Invalid " + arg.name)
-				return false, nil
-			}
-			task.NodeNum = uint32(num)
-		case "--cpus-per-task", "-c":
-			num, err := strconv.ParseFloat(arg.val, 10)
-			if err != nil {
-				log.Print("Invalid " + arg.name)
-				return false, nil
+		if opt := util.LookupResourceOption(arg.name); opt != nil {
+			if err := opt.Set(task, arg.val); err != nil {
+				log.Errorf("At %s: %s", arg.source(), err)
+				return false, nil, ""
 			}
-			task.CpusPerTask = num
-		case "--ntasks-per-node":
-			num, err := strconv.ParseUint(arg.val, 10, 32)
-			if err != nil {
-				log.Print("Invalid " + arg.name)
-				return false, nil
-			}
-			task.NtasksPerNode = uint32(num)
-		case "--time", "-t":
-			isOk := util.ParseDuration(arg.val, task.TimeLimit)
-			if isOk == false {
-				log.Print("Invalid " + arg.name)
-				return false, nil
-			}
-		case "--mem":
-			memInByte, err := util.ParseMemStringAsByte(arg.val)
-			if err != nil {
-				log.Error(err)
-				return false, nil
-			}
-			task.Resources.AllocatableResource.MemoryLimitBytes = memInByte
-			task.Resources.AllocatableResource.MemorySwLimitBytes = memInByte
-		case "-p", "--partition":
-			task.PartitionName = arg.val
-		case "-J", "--job-name":
-			task.Name = arg.val
-		case "-A", "--account":
-			task.Account = arg.val
-		case "--qos", "Q":
-			task.Qos = arg.val
-		case "--chdir":
-			task.Cwd = arg.val
-		case "--exclude", "-x":
-			task.Excludes = arg.val
-		case "--nodelist", "-w":
-			task.Nodelist = arg.val
-		case "--get-user-env":
-			task.GetUserEnv = true
-		case "--export":
-			task.Env["CRANE_EXPORT_ENV"] = arg.val
+			continue
+		}
+
+		switch arg.name {
 		case "-o", "--output":
 			task.GetBatchMeta().OutputFilePattern = arg.val
 		case "-e", "--error":
 			task.GetBatchMeta().ErrorFilePattern = arg.val
+		case "-a", "--array":
+			// The command line has a higher priority.
+			if FlagArray == "" {
+				array = arg.val
+			}
 		default:
 			log.Fatalf("Invalid parameter given: %s\n", arg.name)
 		}
 	}
 
-	// ************* set parameter values based on the command line *********************
-	// If the command line argument is set, it replaces the argument read from the file,
-	// so the command line has a higher priority
-	if FlagNodes != 0 {
-		task.NodeNum = FlagNodes
-	}
-	if FlagCpuPerTask != 0 {
-		task.CpusPerTask = FlagCpuPerTask
-	}
-	if FlagNtasksPerNode != 0 {
-		task.NtasksPerNode = FlagNtasksPerNode
-	}
-	if FlagTime != "" {
-		ok := util.ParseDuration(FlagTime, task.TimeLimit)
-		if ok == false {
-			log.Print("Invalid --time")
-			return false, nil
-		}
-	}
-	if FlagMem != "" {
-		memInByte, err := util.ParseMemStringAsByte(FlagMem)
-		if err != nil {
-			log.Error(err)
-			return false, nil
-		}
-		task.Resources.AllocatableResource.MemoryLimitBytes = memInByte
-		task.Resources.AllocatableResource.MemorySwLimitBytes = memInByte
-	}
-	if FlagPartition != "" {
-		task.PartitionName = FlagPartition
-	}
-	if FlagJob != "" {
-		task.Name = FlagJob
-	}
-	if FlagQos != "" {
-		task.Qos = FlagQos
-	}
-	if FlagCwd != "" {
-		task.Cwd = FlagCwd
+	if !ApplyCbatchFlags(task) {
+		return false, nil, ""
 	}
-	if FlagAccount != "" {
-		task.Account = FlagAccount
-	}
-	if FlagNodelist != "" {
-		task.Nodelist = FlagNodelist
-	}
-	if FlagExcludes != "" {
-		task.Excludes = FlagExcludes
-	}
-	if FlagGetUserEnv != "" {
-		task.GetUserEnv = true
-	}
-	if FlagExport != "" {
-		task.Env["CRANE_EXPORT_ENV"] = FlagExport
+
+	return true, task, array
+}
+
+// ApplyCbatchFlags sets the fields of the task given on the command line.
+// If the command line argument is set, it replaces the argument read from the file,
+// so the command line has a higher priority
+func ApplyCbatchFlags(task *protos.TaskToCtld) bool {
+	if err := FlagResources.Apply(task); err != nil {
+		log.Error(err)
+		return false
 	}
 	if FlagStdoutPath != "" {
 		task.GetBatchMeta().OutputFilePattern = FlagStdoutPath
@@ -182,34 +152,17 @@ func ProcessCbatchArg(args []CbatchArg) (bool, *protos.TaskToCtld) {
 		task.GetBatchMeta().ErrorFilePattern = FlagStderrPath
 	}
 
-	if task.CpusPerTask <= 0 || task.NtasksPerNode == 0 || task.NodeNum == 0 {
-		log.Print("Invalid --cpus-per-task, --ntasks-per-node or --node-num")
-		return false, nil
+	if err := util.CheckResources(task); err != nil {
+		log.Error(err)
+		return false
 	}
 
-	task.Resources.AllocatableResource.CpuCoreLimit = task.CpusPerTask * float64(task.NtasksPerNode)
-
-	return true, task
-}
-
-func ProcessLine(line string, sh *[]string, args *[]CbatchArg) bool {
-	re := regexp.MustCompile(`^#CBATCH`)
-	if re.MatchString(line) {
-		split := strings.Fields(line)
-		if len(split) == 3 {
-			*args = append(*args, CbatchArg{name: split[1], val: split[2]})
-		} else if len(split) == 2 {
-			*args = append(*args, CbatchArg{name: split[1]})
-		} else {
-			return false
-		}
-	} else {
-		*sh = append(*sh, line)
-	}
 	return true
 }
 
-func SendRequest(task *protos.TaskToCtld) {
+// SendRequest submits the task and returns its id. The id is 0 if
+// the submission failed.
+func SendRequest(task *protos.TaskToCtld) uint32 {
 	config := util.ParseConfig(FlagConfigFilePath)
 	stub := util.GetStubToCtldByConfig(config)
 	req := &protos.SubmitBatchTaskRequest{Task: task}
@@ -220,13 +173,21 @@ func SendRequest(task *protos.TaskToCtld) {
 	}
 
 	if reply.GetOk() {
-		fmt.Printf("Task Id allocated: %d\n", reply.GetTaskId())
+		if FlagParsable {
+			fmt.Println(reply.GetTaskId())
+		} else {
+			fmt.Printf(SubmitMessageFormat, reply.GetTaskId())
+		}
+		return reply.GetTaskId()
 	} else {
 		fmt.Printf("Task allocation failed: %s\n", reply.GetReason())
+		return 0
 	}
 }
 
-func SendMultipleRequests(task *protos.TaskToCtld, count uint32) {
+// SendMultipleRequests submits the task count times and returns the ids
+// of the submitted tasks.
+func SendMultipleRequests(task *protos.TaskToCtld, count uint32) []uint32 {
 	config := util.ParseConfig(FlagConfigFilePath)
 	stub := util.GetStubToCtldByConfig(config)
 	req := &protos.SubmitBatchTasksRequest{Task: task, Count: count}
@@ -241,105 +202,92 @@ func SendMultipleRequests(task *protos.TaskToCtld, count uint32) {
 		for i, taskId := range reply.TaskIdList {
 			taskIdListString[i] = strconv.FormatUint(uint64(taskId), 10)
 		}
-		fmt.Printf("Task Id allocated: %s\n", strings.Join(taskIdListString, ", "))
+		if FlagParsable {
+			fmt.Println(strings.Join(taskIdListString, ","))
+		} else {
+			fmt.Printf("Task Id allocated: %s\n", strings.Join(taskIdListString, ", "))
+		}
 	}
 
 	if len(reply.ReasonList) > 0 {
 		fmt.Printf("Failed reasons: %s\n", strings.Join(reply.ReasonList, ", "))
 	}
+	return reply.TaskIdList
 }
 
-func SplitEnvironEntry(env *string) (string, string) {
-	eq := strings.IndexByte(*env, '=')
-	if eq == -1 {
-		return *env, ""
-	} else {
-		return (*env)[:eq], (*env)[eq+1:]
-	}
-}
-
-func SetPropagatedEnviron(task *protos.TaskToCtld) {
-	systemEnv := make(map[string]string)
-	for _, str := range os.Environ() {
-		name, value := SplitEnvironEntry(&str)
-		systemEnv[name] = value
-
-		// The CRANE_* environment variables are loaded anyway.
-		if strings.HasPrefix(name, "CRANE_") {
-			task.Env[name] = value
+// OpenJobScript returns the reader of the job script, which is either
+// generated from --wrap, read from stdin or read from the given file.
+func OpenJobScript(args []string) io.ReadCloser {
+	if FlagWrap != "" {
+		if len(args) > 0 {
+			log.Fatal("A job script can't be given with --wrap")
 		}
+		return io.NopCloser(strings.NewReader("#!/bin/sh\n" + FlagWrap + "\n"))
 	}
 
-	// This value is used only to carry the value of --export flag.
-	// Delete it once we get it.
-	valueOfExportFlag, haveExportFlag := task.Env["CRANE_EXPORT_ENV"]
-	if haveExportFlag {
-		delete(task.Env, "CRANE_EXPORT_ENV")
-	} else {
-		// Default mode is ALL
-		valueOfExportFlag = "ALL"
-	}
-
-	switch valueOfExportFlag {
-	case "NIL":
-	case "NONE":
-		task.GetUserEnv = true
-	case "ALL":
-		task.Env = systemEnv
-
-	default:
-		// The case like "ALL,A=a,B=b", "NIL,C=c"
-		task.GetUserEnv = true
-		splitValueOfExportFlag := strings.Split(valueOfExportFlag, ",")
-		for _, exportValue := range splitValueOfExportFlag {
-			if exportValue == "ALL" {
-				for k, v := range systemEnv {
-					task.Env[k] = v
-				}
-			} else {
-				k, v := SplitEnvironEntry(&exportValue)
-				// If user-specified value is empty, use system value instead.
-				if v != "" {
-					task.Env[k] = v
-				} else {
-					systemEnvValue, envExist := systemEnv[k]
-					if envExist {
-						task.Env[k] = systemEnvValue
-					}
-				}
+	if len(args) == 0 || args[0] == "-" {
+		if len(args) == 0 {
+			stat, err := os.Stdin.Stat()
+			if err == nil && stat.Mode()&os.ModeCharDevice != 0 {
+				log.Fatal("No job script is given. Use a file, '-' for stdin or --wrap")
 			}
 		}
+		return io.NopCloser(os.Stdin)
 	}
+
+	file, err := os.Open(args[0])
+	if err != nil {
+		log.Fatal(err)
+	}
+	return file
 }
 
-func Cbatch(jobFilePath string) {
+func Cbatch(cmdArgs []string) {
 	if FlagRepeat == 0 {
 		log.Fatal("--repeat must >0")
 	}
 
-	file, err := os.Open(jobFilePath)
-	if err != nil {
-		log.Fatal(err)
+	if FlagHistory != 0 {
+		PrintHistory(int(FlagHistory))
+		return
 	}
-	defer func(file *os.File) {
+	if FlagResubmit != 0 {
+		if len(cmdArgs) > 0 || FlagWrap != "" || FlagLint {
+			log.Fatal("--resubmit can't be used with a job script, --wrap or --lint")
+		}
+		Resubmit(FlagResubmit)
+		return
+	}
+
+	file := OpenJobScript(cmdArgs)
+	defer func(file io.ReadCloser) {
 		err := file.Close()
 		if err != nil {
-			log.Printf("Failed to close %s\n", file.Name())
+			log.Printf("Failed to close the job script: %s\n", err)
 		}
 	}(file)
 
+	if FlagLint {
+		name := "<stdin>"
+		if FlagWrap != "" {
+			name = "<wrap>"
+		} else if len(cmdArgs) > 0 && cmdArgs[0] != "-" {
+			name = cmdArgs[0]
+		}
+		exitCode := LintScript(name, file)
+		_ = file.Close()
+		os.Exit(exitCode)
+	}
+
 	scanner := bufio.NewScanner(file)
 	// optionally, resize scanner's capacity for lines over 64K, see next example
-	num := 0
-	sh := make([]string, 0)
-	args := make([]CbatchArg, 0)
-
+	parser := NewScriptParser(TranslateDirectivesEnabled())
+	var script strings.Builder
 	for scanner.Scan() {
-		num++
-		success := ProcessLine(scanner.Text(), &sh, &args)
-		if !success {
-			err = fmt.Errorf("grammer error at line %v", num)
-			fmt.Println(err.Error())
+		script.WriteString(scanner.Text())
+		script.WriteByte('\n')
+		if err := parser.ProcessLine(scanner.Text()); err != nil {
+			fmt.Printf("Invalid directive at %s\n", err)
 			os.Exit(1)
 		}
 	}
@@ -347,11 +295,22 @@ func Cbatch(jobFilePath string) {
 	if err := scanner.Err(); err != nil {
 		log.Fatal(err)
 	}
+	for _, line := range parser.ignoredDirectiveLines {
+		log.Warnf("Directive at line %d is ignored since it follows a command", line)
+	}
+	for _, warning := range parser.warnings {
+		log.Warnf("At %s", warning)
+	}
+	sh := parser.sh
+	args, err := MergeDefaults(parser.Args())
+	if err != nil {
+		log.Fatalf("Failed to load the defaults: %s", err)
+	}
 	// fmt.Printf("Invoking UID: %d\n\n", os.Getuid())
 	// fmt.Printf("Shell script:\n%s\n\n", strings.Join(sh, "\n"))
 	// fmt.Printf("Cbatch args:\n%v\n\n", args)
 
-	ok, task := ProcessCbatchArg(args)
+	ok, task, array := ProcessCbatchArg(args)
 	if !ok {
 		log.Fatalf("Invalid cbatch argument")
 	}
@@ -361,16 +320,66 @@ func Cbatch(jobFilePath string) {
 	task.CmdLine = strings.Join(os.Args, " ")
 
 	// Process the content of --get-user-env
-	SetPropagatedEnviron(task)
+	util.SetPropagatedEnviron(task)
 
 	task.Type = protos.TaskType_Batch
 	if task.Cwd == "" {
 		task.Cwd, _ = os.Getwd()
 	}
 
-	if FlagRepeat == 1 {
-		SendRequest(task)
+	SubmitTask(task, array, ResolveFieldSources(args), script.String())
+}
+
+// SubmitTask runs the submit filters on the task and submits it, or prints
+// it with --test-only. The task is submitted as a job array if array is not
+// empty. The script is the job script as given by the user, which is
+// recorded in the journal together with the task.
+func SubmitTask(task *protos.TaskToCtld, array string, sources map[string]string, script string) {
+	// --test-only works outside the cluster without the config file,
+	// in which case there is no submit filter.
+	if _, err := os.Stat(FlagConfigFilePath); err == nil || FlagTestOnly == "" {
+		config := util.ParseConfig(FlagConfigFilePath)
+		if task, err = util.RunSubmitFilters(config, "cbatch", task); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Job rejected: %s\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if FlagTestOnly != "" {
+		PrintTestOnly(task, sources, FlagTestOnly)
+		return
+	}
+
+	if FlagWait {
+		if FlagRepeat != 1 || array != "" {
+			log.Fatal("--wait can't be used with --repeat or --array")
+		}
+		taskId := SendRequest(task)
+		if taskId == 0 {
+			os.Exit(1)
+		}
+		RecordSubmission([]uint32{taskId}, task, "", script)
+		os.Exit(WaitTask(taskId))
+	}
+
+	if array != "" {
+		if FlagRepeat != 1 {
+			log.Fatal("--repeat can't be used with --array")
+		}
+		spec, err := ParseArraySpec(array)
+		if err != nil {
+			log.Fatalf("Invalid --array: %s", err)
+		}
+		taskIds, err := SendArrayRequests(task, spec)
+		RecordSubmission(taskIds, task, array, script)
+		if err != nil {
+			log.Fatal(err)
+		}
+	} else if FlagRepeat == 1 {
+		if taskId := SendRequest(task); taskId != 0 {
+			RecordSubmission([]uint32{taskId}, task, "", script)
+		}
 	} else {
-		SendMultipleRequests(task, FlagRepeat)
+		RecordSubmission(SendMultipleRequests(task, FlagRepeat), task, "", script)
 	}
 }
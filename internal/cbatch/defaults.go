@@ -0,0 +1,61 @@
+/**
+ * Copyright (c) 2023 Peking University and Peking University
+ * Changsha Institute for Computing and Digital Economy
+ *
+ * CraneSched is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of
+ * the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS,
+ * WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package cbatch
+
+import (
+	"CraneFrontEnd/internal/util"
+	"sort"
+)
+
+// MergeDefaults adds the user and project defaults and then the CBATCH_*
+// environment variables before the directives of the script. Since the
+// last one wins in ProcessCbatchArg, the precedence is command line >
+// directive > environment > project file > user file > built-in.
+func MergeDefaults(scriptArgs []CbatchArg) ([]CbatchArg, error) {
+	fileLayers, err := util.LoadDefaultsFiles("cbatch")
+	if err != nil {
+		return nil, err
+	}
+
+	var args []CbatchArg
+	for _, layer := range fileLayers {
+		args = append(args, defaultsToArgs(layer)...)
+	}
+	if envLayer := util.LoadDefaultsEnv("cbatch"); envLayer != nil {
+		args = append(args, defaultsToArgs(*envLayer)...)
+	}
+	return append(args, scriptArgs...), nil
+}
+
+// defaultsToArgs converts a layer of defaults into directives. Only the
+// resource options shared with calloc and srunx are taken, and the others
+// are ignored since the files are shared by commands.
+func defaultsToArgs(layer util.DefaultsLayer) []CbatchArg {
+	var options []string
+	for option := range layer.Values {
+		if util.LookupResourceOption("--"+option) != nil {
+			options = append(options, option)
+		}
+	}
+	sort.Strings(options)
+
+	var args []CbatchArg
+	for _, option := range options {
+		args = append(args, CbatchArg{name: "--" + option, val: layer.Values[option], prefix: layer.Source})
+	}
+	return args
+}
@@ -0,0 +1,219 @@
+/**
+ * Copyright (c) 2023 Peking University and Peking University
+ * Changsha Institute for Computing and Digital Economy
+ *
+ * CraneSched is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of
+ * the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS,
+ * WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package cbatch
+
+import (
+	"CraneFrontEnd/internal/util"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const DirectivePrefix = "#CBATCH"
+
+// DirectiveError reports where a directive in the job script is malformed.
+// Both line and column start at 1.
+type DirectiveError struct {
+	line   int
+	column int
+	msg    string
+}
+
+func (e *DirectiveError) Error() string {
+	return fmt.Sprintf("line %d, column %d: %s", e.line, e.column, e.msg)
+}
+
+// directiveToken is a word of a directive line after the shell-style
+// quoting is removed. column is where the word begins in the line.
+type directiveToken struct {
+	text   string
+	column int
+}
+
+// ScriptParser splits a job script into directives and shell lines.
+// Like sbatch, directives are only recognized before the first
+// executable line. Later directive lines are kept as shell comments.
+type ScriptParser struct {
+	lineNum      int
+	inDirectives bool
+
+	// Whether #SBATCH and #PBS directives are translated
+	translateForeign bool
+
+	sh          []string
+	args        []CbatchArg
+	foreignArgs []CbatchArg
+	// Lines of the directives after the first executable line
+	ignoredDirectiveLines []int
+	// Problems which don't stop the submission, e.g. untranslatable options
+	warnings []*DirectiveError
+}
+
+func NewScriptParser(translateForeign bool) *ScriptParser {
+	return &ScriptParser{
+		inDirectives:     true,
+		translateForeign: translateForeign,
+		sh:               make([]string, 0),
+		args:             make([]CbatchArg, 0),
+	}
+}
+
+// Args returns all the directives of the script. Translated #SBATCH
+// and #PBS directives come first, so that #CBATCH ones take precedence.
+func (p *ScriptParser) Args() []CbatchArg {
+	return append(append([]CbatchArg{}, p.foreignArgs...), p.args...)
+}
+
+// ProcessLine consumes the next line of the job script.
+func (p *ScriptParser) ProcessLine(line string) error {
+	p.lineNum++
+	p.sh = append(p.sh, line)
+
+	trimmed := strings.TrimSpace(line)
+	if !p.inDirectives {
+		if IsDirectiveLine(line) {
+			p.ignoredDirectiveLines = append(p.ignoredDirectiveLines, p.lineNum)
+		}
+		return nil
+	}
+	if trimmed != "" && !strings.HasPrefix(trimmed, "#") {
+		// The first executable line ends the directives.
+		p.inDirectives = false
+		return nil
+	}
+
+	if IsDirectiveLine(line) {
+		// The directive itself is not a part of the script.
+		p.sh = p.sh[:len(p.sh)-1]
+
+		offset := strings.Index(line, DirectivePrefix) + len(DirectivePrefix)
+		args, err := ParseDirective(line[offset:], p.lineNum, offset+1)
+		if err != nil {
+			return err
+		}
+		p.args = append(p.args, args...)
+		return nil
+	}
+
+	for _, prefix := range []string{SbatchDirectivePrefix, PbsDirectivePrefix} {
+		if !hasDirectivePrefix(line, prefix) {
+			continue
+		}
+		if !p.translateForeign {
+			if len(p.warnings) == 0 {
+				p.warnings = append(p.warnings, &DirectiveError{p.lineNum, 1,
+					fmt.Sprintf("%s directives are ignored unless --translate-directives is given", prefix)})
+			}
+			return nil
+		}
+
+		p.sh = p.sh[:len(p.sh)-1]
+		offset := strings.Index(line, prefix) + len(prefix)
+		args, err := ParseDirective(line[offset:], p.lineNum, offset+1)
+		if err != nil {
+			return err
+		}
+		for _, arg := range args {
+			translated, warnings := TranslateForeignArg(prefix, arg)
+			p.warnings = append(p.warnings, warnings...)
+			for _, t := range translated {
+				t.prefix = prefix
+				p.foreignArgs = append(p.foreignArgs, t)
+			}
+		}
+		return nil
+	}
+
+	return nil
+}
+
+// IsDirectiveLine returns whether the line is a #CBATCH directive.
+// "#CBATCHX" is a plain comment.
+func IsDirectiveLine(line string) bool {
+	return hasDirectivePrefix(line, DirectivePrefix)
+}
+
+func hasDirectivePrefix(line string, prefix string) bool {
+	trimmed := strings.TrimLeft(line, " \t")
+	if !strings.HasPrefix(trimmed, prefix) {
+		return false
+	}
+	rest := trimmed[len(prefix):]
+	return rest == "" || rest[0] == ' ' || rest[0] == '\t'
+}
+
+// ParseDirective parses the options after the directive prefix, e.g.
+// ` --job-name="my job" -N 2 # comment`. column is the column of the
+// first character of the text in the line, used in error messages.
+func ParseDirective(text string, line int, column int) ([]CbatchArg, error) {
+	tokens, err := tokenizeDirective(text, line, column)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, &DirectiveError{line, column, "no option is given"}
+	}
+
+	var args []CbatchArg
+	for i := 0; i < len(tokens); i++ {
+		tok := tokens[i]
+		if !strings.HasPrefix(tok.text, "-") || tok.text == "-" || tok.text == "--" {
+			return nil, &DirectiveError{line, tok.column,
+				fmt.Sprintf("expect an option but got '%s'", tok.text)}
+		}
+
+		arg := CbatchArg{name: tok.text, line: line, column: tok.column}
+		if strings.HasPrefix(tok.text, "--") {
+			if name, val, hasVal := strings.Cut(tok.text, "="); hasVal {
+				arg.name, arg.val = name, val
+				args = append(args, arg)
+				continue
+			}
+		} else if len(tok.text) > 2 {
+			// Short option with an attached value, e.g. -N2.
+			arg.name, arg.val = tok.text[:2], tok.text[2:]
+			args = append(args, arg)
+			continue
+		}
+
+		if i+1 < len(tokens) && !strings.HasPrefix(tokens[i+1].text, "-") {
+			arg.val = tokens[i+1].text
+			i++
+		}
+		args = append(args, arg)
+	}
+
+	return args, nil
+}
+
+// tokenizeDirective splits the text into words like a POSIX shell does,
+// handling single quotes, double quotes, backslash escapes and comments.
+func tokenizeDirective(text string, line int, column int) ([]directiveToken, error) {
+	words, err := util.SplitShellWords(text)
+	var syntaxErr *util.ShellSyntaxError
+	if errors.As(err, &syntaxErr) {
+		return nil, &DirectiveError{line, column + syntaxErr.Offset, syntaxErr.Msg}
+	} else if err != nil {
+		return nil, err
+	}
+
+	var tokens []directiveToken
+	for _, word := range words {
+		tokens = append(tokens, directiveToken{word.Text, column + word.Offset})
+	}
+	return tokens, nil
+}
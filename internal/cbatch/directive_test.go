@@ -0,0 +1,137 @@
+/**
+ * Copyright (c) 2023 Peking University and Peking University
+ * Changsha Institute for Computing and Digital Economy
+ *
+ * CraneSched is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of
+ * the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS,
+ * WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+package cbatch
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestTokenizeDirective(t *testing.T) {
+	tests := []struct {
+		text string
+		want []directiveToken
+	}{
+		{" -N 2", []directiveToken{{"-N", 9}, {"2", 12}}},
+		{` --job-name="my job" # comment`, []directiveToken{{"--job-name=my job", 9}}},
+		{` -o 'out %j.txt'`, []directiveToken{{"-o", 9}, {"out %j.txt", 12}}},
+		{` --comment=a\ b`, []directiveToken{{"--comment=a b", 9}}},
+		{"", nil},
+	}
+
+	for _, tt := range tests {
+		got, err := tokenizeDirective(tt.text, 3, 8)
+		if err != nil {
+			t.Errorf("tokenizeDirective(%q) returned an error: %s", tt.text, err)
+		} else if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("tokenizeDirective(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestParseDirective(t *testing.T) {
+	arg := func(name string, val string, column int) CbatchArg {
+		return CbatchArg{name: name, val: val, line: 3, column: column}
+	}
+	tests := []struct {
+		text string
+		want []CbatchArg
+	}{
+		{" -N 2", []CbatchArg{arg("-N", "2", 9)}},
+		{" -N2", []CbatchArg{arg("-N", "2", 9)}},
+		{" --nodes=2 -c 4", []CbatchArg{arg("--nodes", "2", 9), arg("-c", "4", 19)}},
+		{" --nodes 2", []CbatchArg{arg("--nodes", "2", 9)}},
+		{" --get-user-env -N 2", []CbatchArg{arg("--get-user-env", "", 9), arg("-N", "2", 24)}},
+		{` -J "a b" --export=`, []CbatchArg{arg("-J", "a b", 9), arg("--export", "", 18)}},
+		{" --exclusive", []CbatchArg{arg("--exclusive", "", 9)}},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseDirective(tt.text, 3, 8)
+		if err != nil {
+			t.Errorf("ParseDirective(%q) returned an error: %s", tt.text, err)
+		} else if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseDirective(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestParseDirectiveInvalid(t *testing.T) {
+	tests := []struct {
+		text       string
+		wantColumn int
+		wantMsg    string
+	}{
+		{"", 8, "no option is given"},
+		{" # comment", 8, "no option is given"},
+		{" job", 9, "expect an option but got 'job'"},
+		{" -N 2 3", 14, "expect an option but got '3'"},
+		{" -", 9, "expect an option but got '-'"},
+		{" -J 'a", 12, "unterminated single quote"},
+		{` -J "a`, 12, "unterminated double quote"},
+		{` -J a\`, 13, "dangling backslash"},
+	}
+
+	for _, tt := range tests {
+		_, err := ParseDirective(tt.text, 3, 8)
+		var dirErr *DirectiveError
+		if !errors.As(err, &dirErr) {
+			t.Errorf("ParseDirective(%q) returned %v, want a *DirectiveError", tt.text, err)
+			continue
+		}
+		if dirErr.line != 3 || dirErr.column != tt.wantColumn || dirErr.msg != tt.wantMsg {
+			t.Errorf("ParseDirective(%q) = %v, want line 3, column %d: %s",
+				tt.text, dirErr, tt.wantColumn, tt.wantMsg)
+		}
+	}
+}
+
+func TestScriptParser(t *testing.T) {
+	script := []string{
+		"#!/bin/bash",
+		"#CBATCH -N 2",
+		"# plain comment",
+		"#CBATCHX not a directive",
+		"",
+		"  #CBATCH --job-name=test",
+		"hostname",
+		"#CBATCH -c 4",
+	}
+
+	parser := NewScriptParser(false)
+	for _, line := range script {
+		if err := parser.ProcessLine(line); err != nil {
+			t.Fatalf("ProcessLine(%q) returned an error: %s", line, err)
+		}
+	}
+
+	want := []CbatchArg{
+		{name: "-N", val: "2", line: 2, column: 9},
+		{name: "--job-name", val: "test", line: 6, column: 11},
+	}
+	if got := parser.Args(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Args() = %v, want %v", got, want)
+	}
+	if !reflect.DeepEqual(parser.ignoredDirectiveLines, []int{8}) {
+		t.Errorf("ignoredDirectiveLines = %v, want [8]", parser.ignoredDirectiveLines)
+	}
+	wantSh := []string{"#!/bin/bash", "# plain comment", "#CBATCHX not a directive", "",
+		"hostname", "#CBATCH -c 4"}
+	if !reflect.DeepEqual(parser.sh, wantSh) {
+		t.Errorf("sh = %q, want %q", parser.sh, wantSh)
+	}
+}
@@ -0,0 +1,315 @@
+/**
+ * Copyright (c) 2023 Peking University and Peking University
+ * Changsha Institute for Computing and Digital Economy
+ *
+ * CraneSched is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of
+ * the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS,
+ * WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+package cbatch
+
+import (
+	"CraneFrontEnd/generated/protos"
+	"CraneFrontEnd/internal/util"
+	"encoding/json"
+	"fmt"
+	"github.com/olekukonko/tablewriter"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultJournalMaxEntries = 1000
+	DefaultJournalMaxAgeDays = 90
+)
+
+// JournalEntry is a submission recorded in the journal, one file each.
+// Secret-looking environment variables are not recorded, only their
+// names are, and they are taken from the environment on resubmission.
+type JournalEntry struct {
+	JobIds     []uint32        `json:"job_ids"`
+	SubmitTime time.Time       `json:"submit_time"`
+	Argv       []string        `json:"argv"`
+	Script     string          `json:"script"`
+	Array      string          `json:"array,omitempty"`
+	OmittedEnv []string        `json:"omitted_env,omitempty"`
+	Task       json.RawMessage `json:"task"`
+
+	path string
+}
+
+// JournalDir returns the directory of the journal, which is
+// $XDG_DATA_HOME/crane/history or ~/.local/share/crane/history.
+func JournalDir() (string, error) {
+	dataDir := os.Getenv("XDG_DATA_HOME")
+	if dataDir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dataDir = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(dataDir, "crane", "history"), nil
+}
+
+// RecordSubmission records the submitted task in the journal, where array
+// is the specification of the job array or empty. Failing to record it
+// doesn't fail the submission, so only a warning is printed.
+func RecordSubmission(taskIds []uint32, task *protos.TaskToCtld, array string, script string) {
+	if len(taskIds) == 0 {
+		return
+	}
+	journalConfig := util.ParseConfig(FlagConfigFilePath).SubmissionJournal
+	if journalConfig.Disabled {
+		return
+	}
+	if err := recordSubmission(taskIds, task, array, script); err != nil {
+		log.Warnf("Failed to record the submission in the journal: %s", err)
+		return
+	}
+	if err := pruneJournal(journalConfig); err != nil {
+		log.Warnf("Failed to clean up the journal: %s", err)
+	}
+}
+
+func recordSubmission(taskIds []uint32, task *protos.TaskToCtld, array string, script string) error {
+	dir, err := JournalDir()
+	if err != nil {
+		return err
+	}
+	// The journal contains the environment of the jobs, so it is only
+	// accessible by the user.
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	entry := JournalEntry{
+		JobIds:     taskIds,
+		SubmitTime: time.Now(),
+		Argv:       os.Args,
+		Script:     script,
+		Array:      array,
+	}
+	recorded := proto.Clone(task).(*protos.TaskToCtld)
+	for k := range recorded.Env {
+		if secretEnvPattern.MatchString(k) {
+			entry.OmittedEnv = append(entry.OmittedEnv, k)
+			delete(recorded.Env, k)
+		}
+	}
+	sort.Strings(entry.OmittedEnv)
+	if entry.Task, err = protojson.Marshal(recorded); err != nil {
+		return err
+	}
+
+	content, err := json.MarshalIndent(&entry, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Write to a temporary file first, so that a half-written entry
+	// is never seen.
+	file, err := os.CreateTemp(dir, ".entry-*")
+	if err != nil {
+		return err
+	}
+	if _, err = file.Write(content); err == nil {
+		err = file.Close()
+	} else {
+		_ = file.Close()
+	}
+	if err == nil {
+		name := fmt.Sprintf("%d-%d.json", entry.SubmitTime.Unix(), taskIds[0])
+		err = os.Rename(file.Name(), filepath.Join(dir, name))
+	}
+	if err != nil {
+		_ = os.Remove(file.Name())
+	}
+	return err
+}
+
+// LoadJournal loads all the entries in the journal, the oldest first.
+// Entries that can't be read are skipped with a warning.
+func LoadJournal() ([]*JournalEntry, error) {
+	dir, err := JournalDir()
+	if err != nil {
+		return nil, err
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*JournalEntry
+	for _, path := range paths {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			log.Warnf("Failed to read the journal entry %s: %s", path, err)
+			continue
+		}
+		entry := new(JournalEntry)
+		if err := json.Unmarshal(content, entry); err != nil {
+			log.Warnf("Invalid journal entry %s: %s", path, err)
+			continue
+		}
+		entry.path = path
+		entries = append(entries, entry)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].SubmitTime.Before(entries[j].SubmitTime)
+	})
+	return entries, nil
+}
+
+// pruneJournal removes the entries beyond the retention.
+func pruneJournal(journalConfig util.JournalConfig) error {
+	maxEntries := journalConfig.MaxEntries
+	if maxEntries <= 0 {
+		maxEntries = DefaultJournalMaxEntries
+	}
+	maxAgeDays := journalConfig.MaxAgeDays
+	if maxAgeDays <= 0 {
+		maxAgeDays = DefaultJournalMaxAgeDays
+	}
+
+	entries, err := LoadJournal()
+	if err != nil {
+		return err
+	}
+	deadline := time.Now().AddDate(0, 0, -maxAgeDays)
+	for i, entry := range entries {
+		if len(entries)-i <= maxEntries && entry.SubmitTime.After(deadline) {
+			break
+		}
+		if err := os.Remove(entry.path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// findJournalEntry returns the latest entry in which the job was submitted.
+func findJournalEntry(taskId uint32) (*JournalEntry, error) {
+	entries, err := LoadJournal()
+	if err != nil {
+		return nil, err
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		for _, id := range entries[i].JobIds {
+			if id == taskId {
+				return entries[i], nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("job %d is not found in the journal", taskId)
+}
+
+// taskOfJournalEntry restores the task recorded in the entry. The omitted
+// environment variables are taken from the current environment.
+func taskOfJournalEntry(entry *JournalEntry) (*protos.TaskToCtld, error) {
+	task := new(protos.TaskToCtld)
+	if err := protojson.Unmarshal(entry.Task, task); err != nil {
+		return nil, err
+	}
+	if task.Env == nil {
+		task.Env = make(map[string]string)
+	}
+	if task.TimeLimit == nil {
+		task.TimeLimit = util.InvalidDuration()
+	}
+	for _, k := range entry.OmittedEnv {
+		if v, ok := os.LookupEnv(k); ok {
+			task.Env[k] = v
+		} else {
+			log.Warnf("Environment variable %s is not recorded in the journal and not set now", k)
+		}
+	}
+	return task, nil
+}
+
+// Resubmit submits the job recorded in the journal again, with the
+// options given on the command line overriding the recorded ones.
+func Resubmit(taskId uint32) {
+	entry, err := findJournalEntry(taskId)
+	if err != nil {
+		log.Fatal(err)
+	}
+	task, err := taskOfJournalEntry(entry)
+	if err != nil {
+		log.Fatalf("Invalid journal entry %s: %s", entry.path, err)
+	}
+
+	// --export resolves the environment again from the current one.
+	if FlagResources.Changed("export") {
+		task.Env = make(map[string]string)
+	}
+	if !ApplyCbatchFlags(task) {
+		log.Fatalf("Invalid cbatch argument")
+	}
+	if FlagResources.Changed("export") {
+		util.SetPropagatedEnviron(task)
+	}
+	array := FlagArray
+	if array == "" {
+		array = entry.Array
+	}
+
+	task.Uid = uint32(os.Getuid())
+	task.CmdLine = strings.Join(os.Args, " ")
+
+	sources := ResolveFieldSources(nil)
+	for field, source := range sources {
+		if source == "default" {
+			sources[field] = fmt.Sprintf("journal of job %d", taskId)
+		}
+	}
+	SubmitTask(task, array, sources, entry.Script)
+}
+
+// PrintHistory prints the most recent count submissions in the journal.
+func PrintHistory(count int) {
+	entries, err := LoadJournal()
+	if err != nil {
+		log.Fatalf("Failed to read the journal: %s", err)
+	}
+	if len(entries) > count {
+		entries = entries[len(entries)-count:]
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	util.SetBorderlessTable(table)
+	table.SetHeader([]string{"JOBID", "SUBMIT TIME", "NAME", "PARTITION", "WORKDIR", "COMMAND"})
+	for _, entry := range entries {
+		task := new(protos.TaskToCtld)
+		if err := protojson.Unmarshal(entry.Task, task); err != nil {
+			log.Warnf("Invalid journal entry %s: %s", entry.path, err)
+			continue
+		}
+		jobIds := FormatTaskIdRange(entry.JobIds)
+		if entry.Array != "" {
+			jobIds = strconv.FormatUint(uint64(entry.JobIds[0]), 10) + "[" + entry.Array + "]"
+		}
+		table.Append([]string{
+			jobIds,
+			entry.SubmitTime.Local().Format("2006-01-02T15:04:05"),
+			task.Name,
+			task.PartitionName,
+			task.Cwd,
+			strings.Join(entry.Argv, " "),
+		})
+	}
+	table.Render()
+}
@@ -0,0 +1,157 @@
+/**
+ * Copyright (c) 2023 Peking University and Peking University
+ * Changsha Institute for Computing and Digital Economy
+ *
+ * CraneSched is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of
+ * the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS,
+ * WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+package cbatch
+
+import (
+	"CraneFrontEnd/generated/protos"
+	"CraneFrontEnd/internal/util"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newJournalTask(name string, env map[string]string) *protos.TaskToCtld {
+	task := util.NewTaskToCtld()
+	task.Name = name
+	task.Env = env
+	return task
+}
+
+func TestRecordAndResubmitFromJournal(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+
+	task := newJournalTask("first", map[string]string{"A": "1", "MY_API_TOKEN": "s3cr3t"})
+	if err := recordSubmission([]uint32{10, 11}, task, "0-1", "#!/bin/sh\nhostname\n"); err != nil {
+		t.Fatalf("recordSubmission: %s", err)
+	}
+	if err := recordSubmission([]uint32{11}, newJournalTask("second", nil), "", "#!/bin/sh\n"); err != nil {
+		t.Fatalf("recordSubmission: %s", err)
+	}
+
+	dir, _ := JournalDir()
+	paths, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	for _, path := range paths {
+		content, _ := os.ReadFile(path)
+		if strings.Contains(string(content), "s3cr3t") {
+			t.Errorf("secret environment variable is recorded in %s", path)
+		}
+	}
+
+	entries, err := LoadJournal()
+	if err != nil {
+		t.Fatalf("LoadJournal: %s", err)
+	}
+	if len(entries) != 2 || !reflect.DeepEqual(entries[0].JobIds, []uint32{10, 11}) {
+		t.Fatalf("LoadJournal = %v, want the two entries, the oldest first", entries)
+	}
+	if entries[0].Array != "0-1" || !reflect.DeepEqual(entries[0].OmittedEnv, []string{"MY_API_TOKEN"}) {
+		t.Errorf("entry = %+v, want array 0-1 and MY_API_TOKEN omitted", entries[0])
+	}
+
+	// The latest entry of the job is taken.
+	entry, err := findJournalEntry(11)
+	if err != nil || entry.path != entries[1].path {
+		t.Errorf("findJournalEntry(11) = %v, %v, want the second entry", entry, err)
+	}
+	if _, err := findJournalEntry(12); err == nil {
+		t.Error("findJournalEntry(12) found a job never submitted")
+	}
+
+	entry, _ = findJournalEntry(10)
+	t.Setenv("MY_API_TOKEN", "n3w")
+	resubmitted, err := taskOfJournalEntry(entry)
+	if err != nil {
+		t.Fatalf("taskOfJournalEntry: %s", err)
+	}
+	if resubmitted.Name != "first" {
+		t.Errorf("Name = %q, want %q", resubmitted.Name, "first")
+	}
+	wantEnv := map[string]string{"A": "1", "MY_API_TOKEN": "n3w"}
+	if !reflect.DeepEqual(resubmitted.Env, wantEnv) {
+		t.Errorf("Env = %v, want %v", resubmitted.Env, wantEnv)
+	}
+
+	// An omitted variable not set now is left out.
+	os.Unsetenv("MY_API_TOKEN")
+	resubmitted, _ = taskOfJournalEntry(entry)
+	if _, ok := resubmitted.Env["MY_API_TOKEN"]; ok {
+		t.Error("MY_API_TOKEN is set although it is not in the environment")
+	}
+}
+
+func writeJournalEntry(t *testing.T, dir string, taskId uint32, age time.Duration) {
+	entry := JournalEntry{
+		JobIds:     []uint32{taskId},
+		SubmitTime: time.Now().Add(-age),
+		Task:       json.RawMessage("{}"),
+	}
+	content, err := json.Marshal(&entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Join(dir, strconv.FormatUint(uint64(taskId), 10)+".json")
+	if err := os.WriteFile(name, content, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPruneJournal(t *testing.T) {
+	day := 24 * time.Hour
+	tests := []struct {
+		name    string
+		config  util.JournalConfig
+		ages    []time.Duration
+		wantIds []uint32
+	}{
+		{"within the retention", util.JournalConfig{MaxEntries: 5, MaxAgeDays: 30},
+			[]time.Duration{3 * day, 2 * day, day}, []uint32{1, 2, 3}},
+		{"too many entries", util.JournalConfig{MaxEntries: 2, MaxAgeDays: 30},
+			[]time.Duration{3 * day, 2 * day, day}, []uint32{2, 3}},
+		{"too old entries", util.JournalConfig{MaxEntries: 5, MaxAgeDays: 30},
+			[]time.Duration{40 * day, 31 * day, day}, []uint32{3}},
+		{"defaults", util.JournalConfig{},
+			[]time.Duration{100 * day, 80 * day}, []uint32{2}},
+	}
+
+	for _, tt := range tests {
+		t.Setenv("XDG_DATA_HOME", t.TempDir())
+		dir, _ := JournalDir()
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			t.Fatal(err)
+		}
+		for i, age := range tt.ages {
+			writeJournalEntry(t, dir, uint32(i+1), age)
+		}
+
+		if err := pruneJournal(tt.config); err != nil {
+			t.Errorf("%s: pruneJournal: %s", tt.name, err)
+			continue
+		}
+		entries, _ := LoadJournal()
+		var ids []uint32
+		for _, entry := range entries {
+			ids = append(ids, entry.JobIds[0])
+		}
+		if !reflect.DeepEqual(ids, tt.wantIds) {
+			t.Errorf("%s: jobs left = %v, want %v", tt.name, ids, tt.wantIds)
+		}
+	}
+}
@@ -0,0 +1,295 @@
+/**
+ * Copyright (c) 2023 Peking University and Peking University
+ * Changsha Institute for Computing and Digital Economy
+ *
+ * CraneSched is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of
+ * the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS,
+ * WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package cbatch
+
+import (
+	"CraneFrontEnd/internal/util"
+	"CraneFrontEnd/internal/util/hostlist"
+	"bufio"
+	"errors"
+	"fmt"
+	"golang.org/x/sys/unix"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Exit codes of cbatch --lint
+const (
+	LintExitOk       = 0
+	LintExitError    = 1
+	LintExitWarnOnly = 2
+)
+
+type LintSeverity string
+
+const (
+	LintError   LintSeverity = "error"
+	LintWarning LintSeverity = "warning"
+)
+
+type LintFinding struct {
+	line     int
+	column   int
+	severity LintSeverity
+	msg      string
+}
+
+// KnownDirectiveOptions are the options accepted in #CBATCH directives.
+var KnownDirectiveOptions = knownDirectiveOptions()
+
+// canonicalOption maps a short option to its long form, so that
+// "-N 2" and "--nodes 3" are detected as conflicting.
+var canonicalOption = canonicalOptions()
+
+func knownDirectiveOptions() []string {
+	var options []string
+	for _, opt := range directiveOptions() {
+		options = append(options, opt.names()...)
+	}
+	return options
+}
+
+func canonicalOptions() map[string]string {
+	canonical := make(map[string]string)
+	for _, opt := range directiveOptions() {
+		if opt.shorthand != "" {
+			canonical["-"+opt.shorthand] = "--" + opt.name
+		}
+	}
+	return canonical
+}
+
+type scriptLinter struct {
+	findings []LintFinding
+}
+
+func (l *scriptLinter) report(line int, column int, severity LintSeverity, format string, a ...any) {
+	l.findings = append(l.findings, LintFinding{line, column, severity, fmt.Sprintf(format, a...)})
+}
+
+// LintScript statically checks the job script without contacting CraneCtld.
+// Findings are printed as "name:line:column: severity: message" and the
+// exit code for cbatch is returned.
+func LintScript(name string, script io.Reader) int {
+	findings, err := lintScript(script, TranslateDirectivesEnabled())
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "%s: failed to read the script: %s\n", name, err)
+		return LintExitError
+	}
+
+	numErrors := 0
+	for _, f := range findings {
+		if f.severity == LintError {
+			numErrors++
+		}
+		fmt.Printf("%s:%d:%d: %s: %s\n", name, f.line, f.column, f.severity, f.msg)
+	}
+
+	if numErrors > 0 {
+		return LintExitError
+	} else if len(findings) > 0 {
+		return LintExitWarnOnly
+	}
+	return LintExitOk
+}
+
+// lintScript returns the findings in the script sorted by position.
+func lintScript(script io.Reader, translateForeign bool) ([]LintFinding, error) {
+	l := &scriptLinter{}
+	parser := NewScriptParser(translateForeign)
+
+	scanner := bufio.NewScanner(script)
+	for scanner.Scan() {
+		if parser.lineNum == 0 && !strings.HasPrefix(scanner.Text(), "#!") {
+			l.report(1, 1, LintWarning, "missing shebang line, e.g. #!/bin/bash")
+		}
+
+		var dirErr *DirectiveError
+		if err := parser.ProcessLine(scanner.Text()); errors.As(err, &dirErr) {
+			l.report(dirErr.line, dirErr.column, LintError, "%s", dirErr.msg)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if parser.lineNum == 0 {
+		l.report(1, 1, LintError, "empty job script")
+	}
+
+	for _, line := range parser.ignoredDirectiveLines {
+		l.report(line, 1, LintWarning,
+			"directive after the first command is ignored, move it before the first command")
+	}
+
+	for _, warning := range parser.warnings {
+		l.report(warning.line, warning.column, LintWarning, "%s", warning.msg)
+	}
+
+	l.checkArgs(parser.Args())
+	sort.SliceStable(l.findings, func(i, j int) bool {
+		if l.findings[i].line != l.findings[j].line {
+			return l.findings[i].line < l.findings[j].line
+		}
+		return l.findings[i].column < l.findings[j].column
+	})
+	return l.findings, nil
+}
+
+func (l *scriptLinter) checkArgs(args []CbatchArg) {
+	// Values of the options seen so far, keyed by the long option name.
+	seen := make(map[string]CbatchArg)
+
+	for _, arg := range args {
+		if !isKnownDirectiveOption(arg.name) {
+			if hint := suggestOption(arg.name); hint != "" {
+				l.report(arg.line, arg.column, LintError,
+					"unknown directive %s, did you mean %s?", arg.name, hint)
+			} else {
+				l.report(arg.line, arg.column, LintError, "unknown directive %s", arg.name)
+			}
+			continue
+		}
+
+		if msg := checkOptionValue(arg); msg != "" {
+			l.report(arg.line, arg.column, LintError, "invalid value '%s' of %s: %s", arg.val, arg.name, msg)
+		}
+
+		option := arg.name
+		if long, ok := canonicalOption[option]; ok {
+			option = long
+		}
+		if prev, ok := seen[option]; ok && prev.val != arg.val {
+			l.report(arg.line, arg.column, LintWarning,
+				"%s conflicts with %s at line %d and overrides it", arg.name, prev.name, prev.line)
+		}
+		seen[option] = arg
+	}
+
+	nodelist, hasNodelist := seen["--nodelist"]
+	excludes, hasExcludes := seen["--exclude"]
+	if hasNodelist && hasExcludes {
+		included, err1 := hostlist.Expand(nodelist.val)
+		excluded, err2 := hostlist.Expand(excludes.val)
+		if err1 == nil && err2 == nil {
+			for _, host := range excluded {
+				if contains(included, host) {
+					l.report(excludes.line, excludes.column, LintError,
+						"node %s is both in --nodelist and --exclude", host)
+				}
+			}
+		}
+	}
+
+	if nodes, ok := seen["--nodes"]; ok && hasNodelist {
+		num, err1 := strconv.ParseUint(nodes.val, 10, 32)
+		hosts, err2 := hostlist.Expand(nodelist.val)
+		if err1 == nil && err2 == nil && uint64(len(hosts)) > num {
+			l.report(nodes.line, nodes.column, LintError,
+				"--nodes=%d is fewer than the %d nodes in --nodelist", num, len(hosts))
+		}
+	}
+}
+
+// checkOptionValue returns why the value of the option is invalid,
+// or an empty string if it is valid.
+func checkOptionValue(arg CbatchArg) string {
+	if opt := util.LookupResourceOption(arg.name); opt != nil {
+		if err := opt.Check(arg.val); err != nil {
+			return err.Error()
+		}
+	}
+
+	switch arg.name {
+	case "--array", "-a":
+		if _, err := ParseArraySpec(arg.val); err != nil {
+			return err.Error()
+		}
+	case "--chdir":
+		if stat, err := os.Stat(arg.val); err != nil {
+			return err.Error()
+		} else if !stat.IsDir() {
+			return "not a directory"
+		} else if err := unix.Access(arg.val, unix.R_OK|unix.X_OK); err != nil {
+			return "directory is not readable"
+		}
+	default:
+		if arg.val == "" && util.LookupResourceOption(arg.name) == nil {
+			return "expect a value"
+		}
+	}
+	return ""
+}
+
+func isKnownDirectiveOption(name string) bool {
+	return contains(KnownDirectiveOptions, name)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// suggestOption returns the known option closest to the misspelled one,
+// or an empty string if none is close enough.
+func suggestOption(name string) string {
+	best := ""
+	bestDistance := 3
+	for _, option := range KnownDirectiveOptions {
+		if !strings.HasPrefix(option, "--") {
+			continue
+		}
+		d := editDistance(strings.TrimLeft(name, "-"), option[2:])
+		if d < bestDistance {
+			best, bestDistance = option, d
+		}
+	}
+	return best
+}
+
+// editDistance computes the Levenshtein distance between a and b.
+func editDistance(a string, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = prev[j-1] + cost
+			if prev[j]+1 < cur[j] {
+				cur[j] = prev[j] + 1
+			}
+			if cur[j-1]+1 < cur[j] {
+				cur[j] = cur[j-1] + 1
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,105 @@
+/**
+ * Copyright (c) 2023 Peking University and Peking University
+ * Changsha Institute for Computing and Digital Economy
+ *
+ * CraneSched is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of
+ * the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS,
+ * WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+package cbatch
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLintScript(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   []LintFinding
+	}{
+		{"clean", "#!/bin/bash\n#CBATCH -N 2\n#CBATCH --time=1:00:00\nhostname\n", nil},
+		{"empty", "", []LintFinding{{1, 1, LintError, "empty job script"}}},
+		{"missing shebang", "hostname\n", []LintFinding{
+			{1, 1, LintWarning, "missing shebang line, e.g. #!/bin/bash"}}},
+		{"misspelled option", "#!/bin/bash\n#CBATCH --nodse 2\n", []LintFinding{
+			{2, 9, LintError, "unknown directive --nodse, did you mean --nodes?"}}},
+		{"unknown option", "#!/bin/bash\n#CBATCH --frobnicate\n", []LintFinding{
+			{2, 9, LintError, "unknown directive --frobnicate"}}},
+		{"invalid value", "#!/bin/bash\n#CBATCH -N many\n", []LintFinding{
+			{2, 9, LintError, "invalid value 'many' of -N: expect a positive integer"}}},
+		{"malformed directive", "#!/bin/bash\n#CBATCH -J 'a\n", []LintFinding{
+			{2, 12, LintError, "unterminated single quote"}}},
+		{"conflict", "#!/bin/bash\n#CBATCH -N 2\n#CBATCH --nodes 3\n", []LintFinding{
+			{3, 9, LintWarning, "--nodes conflicts with -N at line 2 and overrides it"}}},
+		{"same value repeated", "#!/bin/bash\n#CBATCH -N 2\n#CBATCH --nodes=2\n", nil},
+		{"directive after command", "#!/bin/bash\nhostname\n#CBATCH -N 2\n", []LintFinding{
+			{3, 1, LintWarning, "directive after the first command is ignored, move it before the first command"}}},
+		{"excluded node in nodelist", "#!/bin/bash\n#CBATCH -w cn[01-03]\n#CBATCH -x cn02\n", []LintFinding{
+			{3, 9, LintError, "node cn02 is both in --nodelist and --exclude"}}},
+		{"fewer nodes than nodelist", "#!/bin/bash\n#CBATCH -w cn[01-03]\n#CBATCH -N 2\n", []LintFinding{
+			{3, 9, LintError, "--nodes=2 is fewer than the 3 nodes in --nodelist"}}},
+		{"sbatch directive not translated", "#!/bin/bash\n#SBATCH -N 2\n", []LintFinding{
+			{2, 1, LintWarning, "#SBATCH directives are ignored unless --translate-directives is given"}}},
+	}
+
+	for _, tt := range tests {
+		got, err := lintScript(strings.NewReader(tt.script), false)
+		if err != nil {
+			t.Errorf("%s: lintScript returned an error: %s", tt.name, err)
+		} else if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: findings = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a    string
+		b    string
+		want int
+	}{
+		{"", "", 0},
+		{"abc", "", 3},
+		{"", "abc", 3},
+		{"nodes", "nodes", 0},
+		{"nodse", "nodes", 2},
+		{"node", "nodes", 1},
+		{"partiton", "partition", 1},
+		{"kitten", "sitting", 3},
+	}
+
+	for _, tt := range tests {
+		if got := editDistance(tt.a, tt.b); got != tt.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestSuggestOption(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"--partiton", "--partition"},
+		{"--node", "--nodes"},
+		{"-nodes", "--nodes"},
+		{"--job-nam", "--job-name"},
+		{"--frobnicate", ""},
+	}
+
+	for _, tt := range tests {
+		if got := suggestOption(tt.name); got != tt.want {
+			t.Errorf("suggestOption(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
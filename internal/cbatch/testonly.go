@@ -0,0 +1,104 @@
+/**
+ * Copyright (c) 2023 Peking University and Peking University
+ * Changsha Institute for Computing and Digital Economy
+ *
+ * CraneSched is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of
+ * the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS,
+ * WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package cbatch
+
+import (
+	"CraneFrontEnd/generated/protos"
+	"encoding/json"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"gopkg.in/yaml.v2"
+	"regexp"
+)
+
+const MaskedEnvValue = "********"
+
+// secretEnvPattern matches the names of the environment variables
+// whose values are masked in the output of --test-only.
+var secretEnvPattern = regexp.MustCompile(`(?i)(SECRET|TOKEN|PASSW(OR)?D|CREDENTIAL|PRIVATE|API_?KEY|ACCESS_?KEY)`)
+
+// ResolveFieldSources returns where each field of the task comes from:
+// the built-in default, a defaults file, the environment, a directive
+// or the command line.
+func ResolveFieldSources(args []CbatchArg) map[string]string {
+	sources := make(map[string]string)
+	for _, opt := range directiveOptions() {
+		if opt.field == "" {
+			continue
+		}
+		sources[opt.field] = "default"
+		// The last directive wins as in ProcessCbatchArg.
+		for _, arg := range args {
+			if contains(opt.names(), arg.name) {
+				sources[opt.field] = arg.source()
+			}
+		}
+		if opt.changed() {
+			sources[opt.field] = "command line"
+		}
+	}
+	return sources
+}
+
+// MaskSecretEnv returns a copy of the task in which the values of
+// secret-looking environment variables are masked.
+func MaskSecretEnv(task *protos.TaskToCtld) *protos.TaskToCtld {
+	masked := proto.Clone(task).(*protos.TaskToCtld)
+	for k := range masked.Env {
+		if secretEnvPattern.MatchString(k) {
+			masked.Env[k] = MaskedEnvValue
+		}
+	}
+	return masked
+}
+
+// PrintTestOnly prints the task that would be submitted together with
+// the sources of its fields in the given format, either yaml or json.
+func PrintTestOnly(task *protos.TaskToCtld, sources map[string]string, format string) {
+	taskJson, err := protojson.MarshalOptions{
+		UseProtoNames:   true,
+		EmitUnpopulated: true,
+	}.Marshal(MaskSecretEnv(task))
+	if err != nil {
+		log.Fatalf("Failed to marshal the task: %s", err)
+	}
+
+	var taskObj map[string]any
+	if err := json.Unmarshal(taskJson, &taskObj); err != nil {
+		log.Fatalf("Failed to marshal the task: %s", err)
+	}
+	output := map[string]any{
+		"task":    taskObj,
+		"sources": sources,
+	}
+
+	var out []byte
+	switch format {
+	case "json":
+		out, err = json.MarshalIndent(output, "", "  ")
+	case "yaml":
+		out, err = yaml.Marshal(output)
+	default:
+		log.Fatalf("Invalid --test-only format %s. Valid formats are yaml and json.", format)
+	}
+	if err != nil {
+		log.Fatalf("Failed to marshal the task: %s", err)
+	}
+	fmt.Println(string(out))
+}
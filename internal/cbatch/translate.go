@@ -0,0 +1,220 @@
+/**
+ * Copyright (c) 2023 Peking University and Peking University
+ * Changsha Institute for Computing and Digital Economy
+ *
+ * CraneSched is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of
+ * the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS,
+ * WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package cbatch
+
+import (
+	"CraneFrontEnd/internal/util"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	SbatchDirectivePrefix = "#SBATCH"
+	PbsDirectivePrefix    = "#PBS"
+)
+
+// sbatchOptions maps the sbatch options to cbatch ones.
+// Options with the same name in both are mapped to themselves.
+var sbatchOptions = map[string]string{
+	"--nodes":           "--nodes",
+	"-N":                "--nodes",
+	"--cpus-per-task":   "--cpus-per-task",
+	"-c":                "--cpus-per-task",
+	"--ntasks-per-node": "--ntasks-per-node",
+	"--time":            "--time",
+	"-t":                "--time",
+	"--mem":             "--mem",
+	"--partition":       "--partition",
+	"-p":                "--partition",
+	"--job-name":        "--job-name",
+	"-J":                "--job-name",
+	"--account":         "--account",
+	"-A":                "--account",
+	"--qos":             "--qos",
+	"-q":                "--qos",
+	"--chdir":           "--chdir",
+	"-D":                "--chdir",
+	"--workdir":         "--chdir",
+	"--exclude":         "--exclude",
+	"-x":                "--exclude",
+	"--nodelist":        "--nodelist",
+	"-w":                "--nodelist",
+	"--get-user-env":    "--get-user-env",
+	"--export":          "--export",
+	"--output":          "--output",
+	"-o":                "--output",
+	"--error":           "--error",
+	"-e":                "--error",
+	"--array":           "--array",
+	"-a":                "--array",
+}
+
+// sbatchUntranslatedOptions are common sbatch options without a cbatch
+// counterpart, with a hint on what to use instead.
+var sbatchUntranslatedOptions = map[string]string{
+	"-n":            "cbatch has no total number of tasks, use --nodes and --ntasks-per-node instead",
+	"--ntasks":      "cbatch has no total number of tasks, use --nodes and --ntasks-per-node instead",
+	"--mem-per-cpu": "cbatch has no memory per cpu, use --mem instead",
+}
+
+// TranslateForeignArg translates an option of a #SBATCH or #PBS directive
+// into cbatch options. A warning is returned for each part of the option
+// that can't be translated, in which case that part is dropped.
+func TranslateForeignArg(prefix string, arg CbatchArg) ([]CbatchArg, []*DirectiveError) {
+	var translated []CbatchArg
+	var errs []error
+	switch prefix {
+	case SbatchDirectivePrefix:
+		translated, errs = translateSbatchArg(arg)
+	case PbsDirectivePrefix:
+		translated, errs = translatePbsArg(arg)
+	}
+
+	var warnings []*DirectiveError
+	for _, err := range errs {
+		warnings = append(warnings, &DirectiveError{arg.line, arg.column,
+			fmt.Sprintf("%s %s", prefix, err)})
+	}
+	return translated, warnings
+}
+
+func translateSbatchArg(arg CbatchArg) ([]CbatchArg, []error) {
+	if hint, ok := sbatchUntranslatedOptions[arg.name]; ok {
+		return nil, []error{fmt.Errorf("option %s is not translated: %s", arg.name, hint)}
+	}
+	name, ok := sbatchOptions[arg.name]
+	if !ok {
+		return nil, []error{fmt.Errorf("option %s is not translated: not supported by cbatch", arg.name)}
+	}
+
+	// The time and memory formats of sbatch are accepted by cbatch as well.
+	val := arg.val
+	return []CbatchArg{{name: name, val: val, line: arg.line, column: arg.column}}, nil
+}
+
+func translatePbsArg(arg CbatchArg) ([]CbatchArg, []error) {
+	newArg := func(name string, val string) CbatchArg {
+		return CbatchArg{name: name, val: val, line: arg.line, column: arg.column}
+	}
+
+	switch arg.name {
+	case "-N":
+		return []CbatchArg{newArg("--job-name", arg.val)}, nil
+	case "-q":
+		return []CbatchArg{newArg("--partition", arg.val)}, nil
+	case "-A":
+		return []CbatchArg{newArg("--account", arg.val)}, nil
+	case "-o":
+		return []CbatchArg{newArg("--output", arg.val)}, nil
+	case "-e":
+		return []CbatchArg{newArg("--error", arg.val)}, nil
+	case "-d", "-w":
+		return []CbatchArg{newArg("--chdir", arg.val)}, nil
+	case "-V":
+		return []CbatchArg{newArg("--export", "ALL")}, nil
+	case "-v":
+		return []CbatchArg{newArg("--export", "ALL,"+arg.val)}, nil
+	case "-t", "-J":
+		return []CbatchArg{newArg("--array", arg.val)}, nil
+	case "-l":
+		// The known resources are translated even if others are not.
+		var translated []CbatchArg
+		var errs []error
+		warned := make(map[string]bool)
+		for _, res := range splitPbsResources(arg.val) {
+			key, val, _ := strings.Cut(res, "=")
+			args, err := translatePbsResource(key, val)
+			if err != nil {
+				if !warned[key] {
+					warned[key] = true
+					errs = append(errs, fmt.Errorf("resource %s of option -l is not translated: %s", key, err))
+				}
+				continue
+			}
+			for _, a := range args {
+				translated = append(translated, newArg(a.name, a.val))
+			}
+		}
+		return translated, errs
+	}
+
+	return nil, []error{fmt.Errorf("option %s is not translated: not supported by cbatch", arg.name)}
+}
+
+// translatePbsResource translates a resource of "#PBS -l" into cbatch
+// options. Only the names and values of the options are set.
+func translatePbsResource(key string, val string) ([]CbatchArg, error) {
+	switch key {
+	case "walltime":
+		// A bare number is in seconds for PBS but in minutes for cbatch.
+		if seconds, err := strconv.ParseUint(val, 10, 32); err == nil {
+			val = fmt.Sprintf("%d:%02d:%02d", seconds/3600, seconds%3600/60, seconds%60)
+		}
+		return []CbatchArg{{name: "--time", val: val}}, nil
+	case "nodes":
+		// nodes=X[:ppn=Y]
+		fields := strings.Split(val, ":")
+		if _, err := strconv.ParseUint(fields[0], 10, 32); err != nil {
+			return nil, fmt.Errorf("only a node count is supported in nodes=%s", val)
+		}
+		translated := []CbatchArg{{name: "--nodes", val: fields[0]}}
+		for _, field := range fields[1:] {
+			k, v, _ := strings.Cut(field, "=")
+			if k != "ppn" {
+				return nil, fmt.Errorf("unknown node property %s", field)
+			}
+			translated = append(translated, CbatchArg{name: "--ntasks-per-node", val: v})
+		}
+		return translated, nil
+	case "ncpus":
+		return []CbatchArg{{name: "--cpus-per-task", val: val}}, nil
+	case "mem":
+		// A bare number is in bytes for PBS but in megabytes for cbatch.
+		if _, err := strconv.ParseUint(val, 10, 64); err == nil {
+			val += "B"
+		}
+		return []CbatchArg{{name: "--mem", val: val}}, nil
+	}
+	return nil, fmt.Errorf("not supported by cbatch")
+}
+
+// splitPbsResources splits "walltime=1:00:00,nodes=2:ppn=4" by commas.
+func splitPbsResources(val string) []string {
+	var resources []string
+	for _, res := range strings.Split(val, ",") {
+		if res = strings.TrimSpace(res); res != "" {
+			resources = append(resources, res)
+		}
+	}
+	return resources
+}
+
+// TranslateDirectivesEnabled returns whether #SBATCH and #PBS directives
+// are translated, by --translate-directives or in the config file.
+func TranslateDirectivesEnabled() bool {
+	if FlagTranslateDirectives {
+		return true
+	}
+	// The config file is optional here, so that cbatch --lint and
+	// --test-only work on machines outside the cluster.
+	if _, err := os.Stat(FlagConfigFilePath); err != nil {
+		return false
+	}
+	return util.ParseConfig(FlagConfigFilePath).TranslateForeignDirectives
+}
@@ -0,0 +1,118 @@
+/**
+ * Copyright (c) 2023 Peking University and Peking University
+ * Changsha Institute for Computing and Digital Economy
+ *
+ * CraneSched is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of
+ * the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS,
+ * WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+package cbatch
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTranslateForeignArg(t *testing.T) {
+	tests := []struct {
+		prefix       string
+		name         string
+		val          string
+		want         []CbatchArg
+		wantWarnings []string
+	}{
+		{SbatchDirectivePrefix, "-N", "2", []CbatchArg{{name: "--nodes", val: "2"}}, nil},
+		{SbatchDirectivePrefix, "--time", "1-00:00:00", []CbatchArg{{name: "--time", val: "1-00:00:00"}}, nil},
+		{SbatchDirectivePrefix, "--workdir", "/tmp", []CbatchArg{{name: "--chdir", val: "/tmp"}}, nil},
+		{SbatchDirectivePrefix, "--ntasks", "8", nil, []string{"#SBATCH option --ntasks is not translated: " +
+			"cbatch has no total number of tasks, use --nodes and --ntasks-per-node instead"}},
+		{SbatchDirectivePrefix, "-n", "8", nil, []string{"#SBATCH option -n is not translated: " +
+			"cbatch has no total number of tasks, use --nodes and --ntasks-per-node instead"}},
+		{SbatchDirectivePrefix, "--mem-per-cpu", "1G", nil, []string{"#SBATCH option --mem-per-cpu is not translated: " +
+			"cbatch has no memory per cpu, use --mem instead"}},
+		{SbatchDirectivePrefix, "--mail-type", "END", nil, []string{"#SBATCH option --mail-type is not translated: " +
+			"not supported by cbatch"}},
+
+		{PbsDirectivePrefix, "-N", "job", []CbatchArg{{name: "--job-name", val: "job"}}, nil},
+		{PbsDirectivePrefix, "-q", "CPU", []CbatchArg{{name: "--partition", val: "CPU"}}, nil},
+		{PbsDirectivePrefix, "-V", "", []CbatchArg{{name: "--export", val: "ALL"}}, nil},
+		{PbsDirectivePrefix, "-v", "A=1", []CbatchArg{{name: "--export", val: "ALL,A=1"}}, nil},
+		{PbsDirectivePrefix, "-J", "1-10", []CbatchArg{{name: "--array", val: "1-10"}}, nil},
+		{PbsDirectivePrefix, "-l", "walltime=1:00:00,nodes=2:ppn=4", []CbatchArg{
+			{name: "--time", val: "1:00:00"}, {name: "--nodes", val: "2"}, {name: "--ntasks-per-node", val: "4"}}, nil},
+		{PbsDirectivePrefix, "-l", "walltime=3600,foo=1,mem=2gb,foo=2,bar", []CbatchArg{
+			{name: "--time", val: "1:00:00"}, {name: "--mem", val: "2gb"}}, []string{
+			"#PBS resource foo of option -l is not translated: not supported by cbatch",
+			"#PBS resource bar of option -l is not translated: not supported by cbatch"}},
+		{PbsDirectivePrefix, "-m", "abe", nil, []string{"#PBS option -m is not translated: not supported by cbatch"}},
+	}
+
+	for _, tt := range tests {
+		arg := CbatchArg{name: tt.name, val: tt.val, line: 2, column: 7}
+		got, warnings := TranslateForeignArg(tt.prefix, arg)
+
+		// The translated options are at the position of the foreign one.
+		for i := range tt.want {
+			tt.want[i].line, tt.want[i].column = 2, 7
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s %s %s: translated = %v, want %v", tt.prefix, tt.name, tt.val, got, tt.want)
+		}
+
+		var gotWarnings []string
+		for _, w := range warnings {
+			if w.line != 2 || w.column != 7 {
+				t.Errorf("%s %s %s: warning at %d:%d, want 2:7", tt.prefix, tt.name, tt.val, w.line, w.column)
+			}
+			gotWarnings = append(gotWarnings, w.msg)
+		}
+		if !reflect.DeepEqual(gotWarnings, tt.wantWarnings) {
+			t.Errorf("%s %s %s: warnings = %q, want %q", tt.prefix, tt.name, tt.val, gotWarnings, tt.wantWarnings)
+		}
+	}
+}
+
+func TestTranslatePbsResource(t *testing.T) {
+	tests := []struct {
+		key     string
+		val     string
+		want    []CbatchArg
+		wantErr bool
+	}{
+		{"walltime", "01:30:00", []CbatchArg{{name: "--time", val: "01:30:00"}}, false},
+		// A bare number is in seconds.
+		{"walltime", "5400", []CbatchArg{{name: "--time", val: "1:30:00"}}, false},
+		{"walltime", "59", []CbatchArg{{name: "--time", val: "0:00:59"}}, false},
+		{"nodes", "3", []CbatchArg{{name: "--nodes", val: "3"}}, false},
+		{"nodes", "2:ppn=8", []CbatchArg{{name: "--nodes", val: "2"}, {name: "--ntasks-per-node", val: "8"}}, false},
+		{"ncpus", "4", []CbatchArg{{name: "--cpus-per-task", val: "4"}}, false},
+		// A bare number is in bytes.
+		{"mem", "1024", []CbatchArg{{name: "--mem", val: "1024B"}}, false},
+		{"mem", "4gb", []CbatchArg{{name: "--mem", val: "4gb"}}, false},
+		{"nodes", "cn01", nil, true},
+		{"nodes", "2:gpus=1", nil, true},
+		{"software", "matlab", nil, true},
+	}
+
+	for _, tt := range tests {
+		got, err := translatePbsResource(tt.key, tt.val)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("translatePbsResource(%q, %q) = %v, want an error", tt.key, tt.val, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("translatePbsResource(%q, %q) returned an error: %s", tt.key, tt.val, err)
+		} else if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("translatePbsResource(%q, %q) = %v, want %v", tt.key, tt.val, got, tt.want)
+		}
+	}
+}
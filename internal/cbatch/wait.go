@@ -0,0 +1,188 @@
+/**
+ * Copyright (c) 2023 Peking University and Peking University
+ * Changsha Institute for Computing and Digital Economy
+ *
+ * CraneSched is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of
+ * the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS,
+ * WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package cbatch
+
+import (
+	"CraneFrontEnd/generated/protos"
+	"CraneFrontEnd/internal/util"
+	"bufio"
+	"context"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	grpccodes "google.golang.org/grpc/codes"
+	grpcstatus "google.golang.org/grpc/status"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	WaitInitialPollInterval = 1 * time.Second
+	WaitMaxPollInterval     = 30 * time.Second
+	// WaitMaxQueryRetries is how many times in a row a query failing with
+	// a transient error is retried before cbatch --wait gives up.
+	WaitMaxQueryRetries = 10
+)
+
+// ExitCodeOfTask converts the exit code of a finished task into the exit
+// code of cbatch --wait. A task killed by signal n exits with 128+n.
+func ExitCodeOfTask(taskInfo *protos.TaskInfo) int {
+	var exitCode int
+	if taskInfo.ExitCode >= util.CraneExitCodeBase {
+		exitCode = 128 + int(taskInfo.ExitCode-util.CraneExitCodeBase)
+	} else {
+		exitCode = int(taskInfo.ExitCode)
+	}
+
+	if exitCode == 0 && taskInfo.Status != protos.TaskStatus_Completed {
+		exitCode = 1
+	}
+	return exitCode
+}
+
+func queryTaskInfo(stub protos.CraneCtldClient, taskId uint32) (*protos.TaskInfo, error) {
+	req := &protos.QueryTasksInfoRequest{
+		FilterTaskIds:               []uint32{taskId},
+		OptionIncludeCompletedTasks: true,
+	}
+	reply, err := stub.QueryTasksInfo(context.Background(), req)
+	if err != nil {
+		return nil, err
+	}
+	if !reply.GetOk() {
+		return nil, fmt.Errorf("CraneCtld failed to query the job")
+	}
+	if len(reply.TaskInfoList) == 0 {
+		return nil, fmt.Errorf("job not found")
+	}
+	return reply.TaskInfoList[0], nil
+}
+
+// isTransientError returns whether a failed query may succeed if it is
+// retried later, e.g. while CraneCtld is restarting.
+func isTransientError(err error) bool {
+	switch grpcstatus.Code(err) {
+	case grpccodes.Unavailable, grpccodes.DeadlineExceeded,
+		grpccodes.ResourceExhausted, grpccodes.Aborted:
+		return true
+	}
+	return false
+}
+
+func cancelTask(stub protos.CraneCtldClient, taskId uint32) {
+	req := &protos.CancelTaskRequest{
+		OperatorUid:   uint32(os.Getuid()),
+		FilterTaskIds: []uint32{taskId},
+		FilterState:   protos.TaskStatus_Invalid,
+	}
+	reply, err := stub.CancelTask(context.Background(), req)
+	if err != nil {
+		util.GrpcErrorPrintf(err, "Failed to cancel job #%d", taskId)
+	}
+	if len(reply.NotCancelledTasks) > 0 {
+		_, _ = fmt.Fprintf(os.Stderr, "Failed to cancel job #%d: %s\n", taskId, reply.NotCancelledReasons[0])
+	} else {
+		_, _ = fmt.Fprintf(os.Stderr, "Job #%d cancelled.\n", taskId)
+	}
+}
+
+// askForCancel returns whether the user wants the job to be cancelled.
+// Another Ctrl-C at the prompt leaves cbatch without cancelling the job.
+func askForCancel(taskId uint32, sigs chan os.Signal) bool {
+	_, _ = fmt.Fprintf(os.Stderr, "\nCancel job #%d? [y/N] ", taskId)
+
+	answerChannel := make(chan string, 1)
+	go func() {
+		answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && answer == "" {
+			answer = "n"
+		}
+		answerChannel <- answer
+	}()
+
+	select {
+	case answer := <-answerChannel:
+		answer = strings.ToLower(strings.TrimSpace(answer))
+		return answer == "y" || answer == "yes"
+	case <-sigs:
+		_, _ = fmt.Fprintf(os.Stderr, "\nStop waiting. Job #%d keeps going.\n", taskId)
+		os.Exit(130)
+	}
+	return false
+}
+
+// WaitTask blocks until the task finishes and returns its exit code.
+// Its messages go to stderr, since stdout may be parsed by scripts, e.g.
+// with --parsable.
+// The interval between two queries grows until WaitMaxPollInterval.
+// Transient gRPC errors are retried with the same backoff, while other
+// errors, including a job that is not found, make cbatch exit with 1.
+func WaitTask(taskId uint32) int {
+	config := util.ParseConfig(FlagConfigFilePath)
+	stub := util.GetStubToCtldByConfig(config)
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT)
+	defer signal.Stop(sigs)
+
+	lastStatus := protos.TaskStatus_Invalid
+	interval := WaitInitialPollInterval
+	retries := 0
+	for {
+		taskInfo, err := queryTaskInfo(stub, taskId)
+		if err != nil {
+			if !isTransientError(err) || retries >= WaitMaxQueryRetries {
+				_, _ = fmt.Fprintf(os.Stderr, "Failed to query job #%d: %s.\n", taskId, err)
+				return 1
+			}
+			retries++
+			log.Warnf("Failed to query job #%d: %s. Retrying in %s...", taskId, err, interval)
+		} else {
+			retries = 0
+			if taskInfo.Status != lastStatus {
+				lastStatus = taskInfo.Status
+				_, _ = fmt.Fprintf(os.Stderr, "Job #%d is %s.\n", taskId, lastStatus.String())
+			}
+
+			switch taskInfo.Status {
+			case protos.TaskStatus_Pending, protos.TaskStatus_Running:
+			default:
+				exitCode := ExitCodeOfTask(taskInfo)
+				log.Debugf("Job #%d exited with code %d", taskId, taskInfo.ExitCode)
+				return exitCode
+			}
+		}
+
+		select {
+		case <-time.After(interval):
+		case <-sigs:
+			if askForCancel(taskId, sigs) {
+				cancelTask(stub, taskId)
+			}
+			// Check the state at once after the prompt.
+			interval = WaitInitialPollInterval
+			continue
+		}
+
+		interval *= 2
+		if interval > WaitMaxPollInterval {
+			interval = WaitMaxPollInterval
+		}
+	}
+}
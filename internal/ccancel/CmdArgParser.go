@@ -30,7 +30,7 @@ var (
 	FlagState          string   //单个. 默认值
 	FlagAccount        string   //单个.
 	FlagUserName       string   //单个.
-	FlagNodes          []string //多个
+	FlagNodes          []string //多个. 主机列表表达式
 	FlagConfigFilePath string
 
 	rootCmd = &cobra.Command{
@@ -97,5 +97,5 @@ func init() {
 	rootCmd.Flags().StringVarP(&FlagUserName, "user", "u", "",
 		"cancel jobs run by the user")
 	rootCmd.Flags().StringSliceVarP(&FlagNodes, "nodes", "w", nil,
-		"cancel jobs running on the nodes")
+		"cancel jobs running on the nodes, e.g. cn[01-04],gpu1")
 }
@@ -19,6 +19,7 @@ package ccancel
 import (
 	"CraneFrontEnd/generated/protos"
 	"CraneFrontEnd/internal/util"
+	"CraneFrontEnd/internal/util/hostlist"
 	"context"
 	"fmt"
 	"os"
@@ -67,7 +68,16 @@ func CancelTask(args []string) {
 		}
 	}
 
-	req.FilterNodes = FlagNodes
+	if FlagNodes != nil {
+		// The slice is split at every comma, including the ones inside
+		// brackets like cn[01,03], so the host list is joined back first.
+		nodes, err := hostlist.Expand(strings.Join(FlagNodes, ","))
+		if err != nil {
+			fmt.Printf("Invalid --nodes: %s\n", err)
+			os.Exit(1)
+		}
+		req.FilterNodes = nodes
+	}
 
 	reply, err := stub.CancelTask(context.Background(), req)
 	if err != nil {
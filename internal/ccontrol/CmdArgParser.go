@@ -94,6 +94,18 @@ var (
 			ShowTasks(FlagTaskId, FlagQueryAll)
 		},
 	}
+	showHostnamesCmd = &cobra.Command{
+		Use:   "hostnames <host list>",
+		Short: "print the host names in a host list expression, one per line",
+		Long:  "",
+		Args:  cobra.ExactArgs(1),
+		// Host names are expanded locally, so neither the config file
+		// nor CraneCtld is needed.
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {},
+		Run: func(cmd *cobra.Command, args []string) {
+			ShowHostnames(args[0])
+		},
+	}
 	updateCmd = &cobra.Command{
 		Use:   "update",
 		Short: "Modify job information",
@@ -118,6 +130,7 @@ func init() {
 	showCmd.AddCommand(showNodeCmd)
 	showCmd.AddCommand(showPartitionCmd)
 	showCmd.AddCommand(showTaskCmd)
+	showCmd.AddCommand(showHostnamesCmd)
 	rootCmd.AddCommand(updateCmd)
 	updateCmd.Flags().Uint32VarP(&FlagTaskId, "job", "J", 0, "Job id")
 	updateCmd.Flags().StringVarP(&FlagTimeLimit, "time-limit", "T", "", "time limit")
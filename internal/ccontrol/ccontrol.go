@@ -19,13 +19,12 @@ package ccontrol
 import (
 	"CraneFrontEnd/generated/protos"
 	"CraneFrontEnd/internal/util"
+	"CraneFrontEnd/internal/util/hostlist"
 	"context"
 	"fmt"
 	log "github.com/sirupsen/logrus"
 	"math"
 	"os"
-	"regexp"
-	"strconv"
 	"strings"
 	"time"
 )
@@ -190,31 +189,11 @@ func ShowTasks(taskId uint32, queryAll bool) {
 }
 
 func ChangeTaskTimeLimit(taskId uint32, timeLimit string) {
-	re := regexp.MustCompile(`((.*)-)?(.*):(.*):(.*)`)
-	result := re.FindAllStringSubmatch(timeLimit, -1)
-
-	if result == nil || len(result) != 1 {
-		log.Fatalf("Time format error")
-	}
-	var dd uint64
-	if result[0][2] != "" {
-		dd, _ = strconv.ParseUint(result[0][2], 10, 32)
-	}
-	hh, err := strconv.ParseUint(result[0][3], 10, 32)
-	if err != nil {
-		log.Fatalf("The hour time format error")
-	}
-	mm, err := strconv.ParseUint(result[0][4], 10, 32)
-	if err != nil {
-		log.Fatalf("The minute time format error")
-	}
-	ss, err := strconv.ParseUint(result[0][5], 10, 32)
+	seconds, err := util.ParseDurationSeconds(timeLimit)
 	if err != nil {
-		log.Fatalf("The second time format error")
+		log.Fatalf("Invalid time limit: %s", err)
 	}
 
-	seconds := int64(60*60*24*dd + 60*60*hh + 60*mm + ss)
-
 	var req *protos.ModifyTaskRequest
 
 	req = &protos.ModifyTaskRequest{
@@ -236,3 +215,13 @@ func ChangeTaskTimeLimit(taskId uint32, timeLimit string) {
 		fmt.Printf("Chang time limit failed: %s\n", reply.GetReason())
 	}
 }
+
+func ShowHostnames(hostList string) {
+	hosts, err := hostlist.Expand(hostList)
+	if err != nil {
+		log.Fatalf("Invalid host list: %s", err)
+	}
+	for _, host := range hosts {
+		fmt.Println(host)
+	}
+}
@@ -176,7 +176,7 @@ CtldClientStateMachineLoop:
 						gVars.ctldConnected.Store(true)
 						state = WaitChannelReq
 					} else {
-						log.Error("[Cfored<->Ctld] Failed to register with CraneCtld: %s. Exiting...",
+						log.Errorf("[Cfored<->Ctld] Failed to register with CraneCtld: %s. Exiting...",
 							reply.GetPayloadCforedRegAck().FailureReason)
 						gVars.globalCtxCancel()
 						break CtldClientStateMachineLoop
@@ -413,35 +413,85 @@ func RequestReceiveRoutine(stream protos.CraneForeD_CallocStreamServer, requestC
 	}
 }
 
-func (cforedServer *GrpcCforedServer) QueryTaskIdFromPort(ctx context.Context,
-	request *protos.QueryTaskIdFromPortRequest) (*protos.QueryTaskIdFromPortReply, error) {
-
-	var taskId uint32
-	var ok bool
-
-	pid, err := util.GetPidFromPort(uint16(request.Port))
-	if err != nil {
-		return &protos.QueryTaskIdFromPortReply{Ok: false}, nil
-	}
+// queryTaskIdFromPid walks up the process tree from pid until a calloc
+// with task id allocated is found.
+func queryTaskIdFromPid(pid int) (uint32, bool) {
+	var err error
 
 	for {
 		gVars.pidTaskIdMapMtx.RLock()
-		taskId, ok = gVars.pidTaskIdMap[int32(pid)]
+		taskId, ok := gVars.pidTaskIdMap[int32(pid)]
 		gVars.pidTaskIdMapMtx.RUnlock()
 
 		if ok {
-			return &protos.QueryTaskIdFromPortReply{
-				Ok:     true,
-				TaskId: taskId,
-			}, nil
+			return taskId, true
 		}
 
 		pid, err = util.GetParentProcessID(pid)
-		if err != nil || pid == 1 {
-			return &protos.QueryTaskIdFromPortReply{Ok: false}, nil
+		if err != nil || pid <= 1 {
+			return 0, false
 		}
 	}
 }
+
+func (cforedServer *GrpcCforedServer) QueryTaskIdFromPort(ctx context.Context,
+	request *protos.QueryTaskIdFromPortRequest) (*protos.QueryTaskIdFromPortReply, error) {
+
+	pid, err := util.GetPidFromPort(uint16(request.Port))
+	if err != nil {
+		return &protos.QueryTaskIdFromPortReply{Ok: false}, nil
+	}
+
+	taskId, ok := queryTaskIdFromPid(pid)
+	return &protos.QueryTaskIdFromPortReply{
+		Ok:     ok,
+		TaskId: taskId,
+	}, nil
+}
+
+// QueryTaskIdFromPid finds the calloc which the client is started from.
+// The pid in the request is ignored. The one of the client process is
+// taken from the unix socket instead, so that the task of another user
+// can't be found.
+func (cforedServer *GrpcCforedServer) QueryTaskIdFromPid(ctx context.Context,
+	request *protos.QueryTaskIdFromPidRequest) (*protos.QueryTaskIdFromPidReply, error) {
+
+	pid, ok := peerPid(ctx)
+	if !ok {
+		return &protos.QueryTaskIdFromPidReply{Ok: false}, nil
+	}
+	taskId, ok := queryTaskIdFromPid(int(pid))
+	return &protos.QueryTaskIdFromPidReply{
+		Ok:     ok,
+		TaskId: taskId,
+	}, nil
+}
+
+// forwardTaskCompletionToCtld asks CraneCtld to complete the task
+// on behalf of calloc.
+func forwardTaskCompletionToCtld(taskId uint32) {
+	gVars.cforedRequestChannel <- &protos.StreamCforedRequest{
+		Type: protos.StreamCforedRequest_TASK_COMPLETION_REQUEST,
+		Payload: &protos.StreamCforedRequest_PayloadTaskCompleteReq{
+			PayloadTaskCompleteReq: &protos.StreamCforedRequest_TaskCompleteReq{
+				CforedName: gVars.hostName,
+				TaskId:     taskId,
+			},
+		},
+	}
+}
+
+func taskCompletionAckReply() *protos.StreamCforedReply {
+	return &protos.StreamCforedReply{
+		Type: protos.StreamCforedReply_TASK_COMPLETION_ACK_REPLY,
+		Payload: &protos.StreamCforedReply_PayloadTaskCompletionAckReply{
+			PayloadTaskCompletionAckReply: &protos.StreamCforedReply_TaskCompletionAckReply{
+				Ok: true,
+			},
+		},
+	}
+}
+
 func (cforedServer *GrpcCforedServer) CallocStream(toCallocStream protos.CraneForeD_CallocStreamServer) error {
 	var callocPid int32
 	var taskId uint32
@@ -455,6 +505,13 @@ func (cforedServer *GrpcCforedServer) CallocStream(toCallocStream protos.CraneFo
 	taskId = math.MaxUint32
 	callocPid = -1
 
+	// Whether calloc has given up or died before the task id is allocated,
+	// in which case the task is completed as soon as the id is known.
+	completionPending := false
+	callocDead := false
+	// Whether callocPid is told by the kernel rather than by calloc.
+	callocPidVerified := false
+
 	state := WaitTaskIdAllocReq
 
 CforedStateMachineLoop:
@@ -501,7 +558,14 @@ CforedStateMachineLoop:
 				// No need to cleaning any data
 				break CforedStateMachineLoop
 			} else {
-				callocPid = callocRequest.GetPayloadTaskReq().CallocPid
+				// The pid of calloc is taken from the unix socket, since
+				// srunx finds its calloc by the pids of the ancestors.
+				if pid, ok := peerPid(toCallocStream.Context()); ok {
+					callocPid = pid
+					callocPidVerified = true
+				} else {
+					callocPid = callocRequest.GetPayloadTaskReq().CallocPid
+				}
 
 				gVars.ctldReplyChannelMapMtx.Lock()
 				gVars.ctldReplyChannelMapByPid[callocPid] = ctldReplyChannel
@@ -529,12 +593,21 @@ CforedStateMachineLoop:
 			select {
 			case item := <-requestChannel:
 				callocRequest, err := item.request, item.err
-				if callocRequest != nil || err == nil {
-					log.Fatal("[Cfored<->Calloc] Expect only nil (calloc connection broken) here!")
+				if err != nil {
+					log.Debug("[Cfored<->Calloc] Connection to calloc was broken.")
+					callocDead = true
+					completionPending = true
+					break
 				}
-				log.Debug("[Cfored<->Calloc] Connection to calloc was broken.")
 
-				state = CancelTaskOfDeadCalloc
+				// calloc gives up waiting for the allocation.
+				if callocRequest.Type != protos.StreamCallocRequest_TASK_COMPLETION_REQUEST {
+					log.Fatal("[Cfored<->Calloc] Expect TASK_COMPLETION_REQUEST")
+				}
+
+				// The request is forwarded once CraneCtld tells the task id.
+				log.Debug("[Cfored<->Calloc] Receive TaskCompletionRequest before the task id is allocated")
+				completionPending = true
 
 			case ctldReply := <-ctldReplyChannel:
 				if ctldReply.Type != protos.StreamCtldReply_TASK_ID_REPLY {
@@ -560,12 +633,37 @@ CforedStateMachineLoop:
 				if Ok {
 					gVars.ctldReplyChannelMapByTaskId[taskId] = ctldReplyChannel
 
-					gVars.pidTaskIdMapMtx.Lock()
-					gVars.pidTaskIdMap[callocPid] = taskId
-					gVars.pidTaskIdMapMtx.Unlock()
+					// The pid of a calloc connected by tcp can't be trusted,
+					// nor is it a local process.
+					if callocPidVerified {
+						gVars.pidTaskIdMapMtx.Lock()
+						gVars.pidTaskIdMap[callocPid] = taskId
+						gVars.pidTaskIdMapMtx.Unlock()
+					}
 				}
 				gVars.ctldReplyChannelMapMtx.Unlock()
 
+				if completionPending {
+					if !Ok {
+						// There is no task to complete.
+						if !callocDead {
+							if err := toCallocStream.Send(taskCompletionAckReply()); err != nil {
+								log.Debug("[Cfored<->Calloc] Connection to calloc was broken.")
+							}
+						}
+						break CforedStateMachineLoop
+					}
+
+					if callocDead {
+						state = CancelTaskOfDeadCalloc
+					} else {
+						log.Debugf("[Cfored<->Calloc] Forward the pending TaskCompletionRequest of task #%d", taskId)
+						forwardTaskCompletionToCtld(taskId)
+						state = WaitCtldAck
+					}
+					break
+				}
+
 				if err := toCallocStream.Send(reply); err != nil {
 					log.Debug("[Cfored<->Calloc] Connection to calloc was broken.")
 					state = CancelTaskOfDeadCalloc
@@ -585,12 +683,21 @@ CforedStateMachineLoop:
 			select {
 			case item := <-requestChannel:
 				callocRequest, err := item.request, item.err
-				if callocRequest != nil || err == nil {
-					log.Fatal("[Cfored<->Calloc] Expect only nil (calloc connection broken) here!")
+				if err != nil {
+					log.Debug("[Cfored<->Calloc] Connection to calloc was broken.")
+					state = CancelTaskOfDeadCalloc
+					break
 				}
-				log.Debug("[Cfored<->Calloc] Connection to calloc was broken.")
 
-				state = CancelTaskOfDeadCalloc
+				// calloc gives up waiting for the allocation.
+				if callocRequest.Type != protos.StreamCallocRequest_TASK_COMPLETION_REQUEST {
+					log.Fatal("[Cfored<->Calloc] Expect TASK_COMPLETION_REQUEST")
+				}
+
+				log.Debug("[Cfored<->Calloc] Receive TaskCompletionRequest of a pending task")
+				forwardTaskCompletionToCtld(taskId)
+
+				state = WaitCtldAck
 
 			case ctldReply := <-ctldReplyChannel:
 				switch ctldReply.Type {
@@ -663,16 +770,7 @@ CforedStateMachineLoop:
 					}
 
 					log.Debug("[Cfored<->Calloc] Receive TaskCompletionRequest")
-					toCtldRequest := &protos.StreamCforedRequest{
-						Type: protos.StreamCforedRequest_TASK_COMPLETION_REQUEST,
-						Payload: &protos.StreamCforedRequest_PayloadTaskCompleteReq{
-							PayloadTaskCompleteReq: &protos.StreamCforedRequest_TaskCompleteReq{
-								CforedName: gVars.hostName,
-								TaskId:     taskId,
-							},
-						},
-					}
-					gVars.cforedRequestChannel <- toCtldRequest
+					forwardTaskCompletionToCtld(taskId)
 
 					state = WaitCtldAck
 				}
@@ -713,16 +811,7 @@ CforedStateMachineLoop:
 
 					log.Debug("[Cfored<->Calloc] Receive TaskCompletionRequest")
 
-					toCtldRequest := &protos.StreamCforedRequest{
-						Type: protos.StreamCforedRequest_TASK_COMPLETION_REQUEST,
-						Payload: &protos.StreamCforedRequest_PayloadTaskCompleteReq{
-							PayloadTaskCompleteReq: &protos.StreamCforedRequest_TaskCompleteReq{
-								CforedName: gVars.hostName,
-								TaskId:     taskId,
-							},
-						},
-					}
-					gVars.cforedRequestChannel <- toCtldRequest
+					forwardTaskCompletionToCtld(taskId)
 
 					state = WaitCtldAck
 				}
@@ -732,22 +821,27 @@ CforedStateMachineLoop:
 			log.Debug("[Cfored<->Calloc] Enter State WAIT_CTLD_ACK")
 
 			ctldReply := <-ctldReplyChannel
+			// The allocation or the cancellation of a pending task may
+			// cross with its completion request.
+			if ctldReply.Type == protos.StreamCtldReply_TASK_RES_ALLOC_REPLY ||
+				ctldReply.Type == protos.StreamCtldReply_TASK_CANCEL_REQUEST {
+				log.Debugf("[Cfored<->Calloc] Ignored %s while waiting for "+
+					"TASK_COMPLETION_ACK_REPLY", ctldReply.Type)
+				break
+			}
 			if ctldReply.Type != protos.StreamCtldReply_TASK_COMPLETION_ACK_REPLY {
 				log.Fatalf("[Cfored<->Calloc] Expect TASK_COMPLETION_ACK_REPLY, "+
 					"but %s received.", ctldReply.Type)
 			}
 
-			reply = &protos.StreamCforedReply{
-				Type: protos.StreamCforedReply_TASK_COMPLETION_ACK_REPLY,
-				Payload: &protos.StreamCforedReply_PayloadTaskCompletionAckReply{
-					PayloadTaskCompletionAckReply: &protos.StreamCforedReply_TaskCompletionAckReply{
-						Ok: true,
-					},
-				},
-			}
+			reply = taskCompletionAckReply()
 
 			gVars.ctldReplyChannelMapMtx.Lock()
 			delete(gVars.ctldReplyChannelMapByTaskId, taskId)
+
+			gVars.pidTaskIdMapMtx.Lock()
+			delete(gVars.pidTaskIdMap, callocPid)
+			gVars.pidTaskIdMapMtx.Unlock()
 			gVars.ctldReplyChannelMapMtx.Unlock()
 
 			if err := toCallocStream.Send(reply); err != nil {
@@ -760,16 +854,7 @@ CforedStateMachineLoop:
 		case CancelTaskOfDeadCalloc:
 			log.Debug("[Cfored<->Calloc] Enter State CANCEL_TASK_OF_DEAD_CALLOC")
 
-			toCtldRequest := &protos.StreamCforedRequest{
-				Type: protos.StreamCforedRequest_TASK_COMPLETION_REQUEST,
-				Payload: &protos.StreamCforedRequest_PayloadTaskCompleteReq{
-					PayloadTaskCompleteReq: &protos.StreamCforedRequest_TaskCompleteReq{
-						CforedName: gVars.hostName,
-						TaskId:     taskId,
-					},
-				},
-			}
-			gVars.cforedRequestChannel <- toCtldRequest
+			forwardTaskCompletionToCtld(taskId)
 
 			gVars.ctldReplyChannelMapMtx.Lock()
 			if taskId != math.MaxUint32 {
@@ -842,6 +927,7 @@ func StartCfored() {
 	tcpListenSocket, err := util.GetListenSocketByConfig(config)
 
 	var opts []grpc.ServerOption
+	opts = append(opts, grpc.Creds(peerCredentials{}))
 	grpcServer := grpc.NewServer(opts...)
 
 	cforedServer := GrpcCforedServer{}
@@ -0,0 +1,99 @@
+/**
+ * Copyright (c) 2023 Peking University and Peking University
+ * Changsha Institute for Computing and Digital Economy
+ *
+ * CraneSched is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of
+ * the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS,
+ * WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package cfored
+
+import (
+	"context"
+	"golang.org/x/sys/unix"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"net"
+)
+
+// peerCredentials are the transport credentials of cfored. For a
+// connection on the unix socket, the process on the other end is
+// recorded as reported by the kernel, so that a client can't claim to be
+// another process. Other connections are passed through as they are.
+type peerCredentials struct{}
+
+// peerCredAuthInfo is the AuthInfo of a connection. ucred is nil if the
+// connection is not on the unix socket.
+type peerCredAuthInfo struct {
+	credentials.CommonAuthInfo
+	ucred *unix.Ucred
+}
+
+func (peerCredAuthInfo) AuthType() string {
+	return "peercred"
+}
+
+func (peerCredentials) ClientHandshake(_ context.Context, _ string,
+	conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	return conn, peerCredAuthInfo{CommonAuthInfo: credentials.CommonAuthInfo{
+		SecurityLevel: credentials.NoSecurity}}, nil
+}
+
+func (peerCredentials) ServerHandshake(conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	info := peerCredAuthInfo{CommonAuthInfo: credentials.CommonAuthInfo{
+		SecurityLevel: credentials.NoSecurity}}
+
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		return conn, info, nil
+	}
+	rawConn, err := unixConn.SyscallConn()
+	if err != nil {
+		return nil, nil, err
+	}
+	var credErr error
+	err = rawConn.Control(func(fd uintptr) {
+		info.ucred, credErr = unix.GetsockoptUcred(int(fd), unix.SOL_SOCKET, unix.SO_PEERCRED)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if credErr != nil {
+		return nil, nil, credErr
+	}
+	return conn, info, nil
+}
+
+func (peerCredentials) Info() credentials.ProtocolInfo {
+	return credentials.ProtocolInfo{SecurityProtocol: "insecure"}
+}
+
+func (c peerCredentials) Clone() credentials.TransportCredentials {
+	return c
+}
+
+func (peerCredentials) OverrideServerName(string) error {
+	return nil
+}
+
+// peerPid returns the pid of the process on the other end of the unix
+// socket the request comes from.
+func peerPid(ctx context.Context) (int32, bool) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return 0, false
+	}
+	info, ok := p.AuthInfo.(peerCredAuthInfo)
+	if !ok || info.ucred == nil {
+		return 0, false
+	}
+	return info.ucred.Pid, true
+}
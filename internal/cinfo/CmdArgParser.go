@@ -61,7 +61,7 @@ func init() {
 	RootCmd.Flags().StringSliceVarP(&FlagFilterPartitions, "partition", "p",
 		nil, "report on specific partition")
 	RootCmd.Flags().StringSliceVarP(&FlagFilterNodes, "nodes", "n", nil,
-		"report on specific node(s)")
+		"report on specific node(s), e.g. cn[01-04],gpu1")
 	RootCmd.Flags().StringSliceVarP(&FlagFilterCranedStates, "states", "t", nil,
 		"Include craned nodes only with certain states. \n"+
 			"The state can take IDLE, MIX, ALLOC and DOWN and is case-insensitive. \n"+
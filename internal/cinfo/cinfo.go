@@ -19,6 +19,7 @@ package cinfo
 import (
 	"CraneFrontEnd/generated/protos"
 	"CraneFrontEnd/internal/util"
+	"CraneFrontEnd/internal/util/hostlist"
 	"context"
 	"fmt"
 	"github.com/olekukonko/tablewriter"
@@ -35,7 +36,15 @@ func cinfoFunc() {
 
 	req := &protos.QueryClusterInfoRequest{
 		FilterPartitions: FlagFilterPartitions,
-		FilterNodes:      FlagFilterNodes,
+	}
+	if FlagFilterNodes != nil {
+		// The slice is split at every comma, including the ones inside
+		// brackets like cn[01,03], so the host list is joined back first.
+		nodes, err := hostlist.Expand(strings.Join(FlagFilterNodes, ","))
+		if err != nil {
+			log.Fatalf("Invalid --nodes: %s\n", err)
+		}
+		req.FilterNodes = nodes
 	}
 
 	var stateList []protos.CranedState
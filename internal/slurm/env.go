@@ -0,0 +1,67 @@
+/**
+ * Copyright (c) 2023 Peking University and Peking University
+ * Changsha Institute for Computing and Digital Economy
+ *
+ * CraneSched is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of
+ * the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS,
+ * WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package slurm
+
+import "strings"
+
+// SlurmEnvPrelude exports a SLURM_* alias for every CRANE_* environment
+// variable of the job, e.g. SLURM_JOB_ID for CRANE_JOB_ID.
+const SlurmEnvPrelude = `# Slurm compatible environment variables
+for __crane_var in $(env | sed -n 's/^CRANE_\([A-Za-z0-9_]*\)=.*/\1/p'); do
+  eval "export SLURM_${__crane_var}=\"\${CRANE_${__crane_var}}\""
+done
+unset __crane_var
+if [ -n "${SLURM_JOB_ID}" ]; then export SLURM_JOBID="${SLURM_JOB_ID}"; fi
+if [ -n "${SLURM_JOB_NODELIST}" ]; then export SLURM_NODELIST="${SLURM_JOB_NODELIST}"; fi`
+
+// InsertAfterDirectives inserts the text before the first executable
+// line of the script, so that the directives before it still take effect.
+func InsertAfterDirectives(script string, text string) string {
+	lines := strings.Split(script, "\n")
+	i := 0
+	for ; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		if trimmed != "" && !strings.HasPrefix(trimmed, "#") {
+			break
+		}
+	}
+
+	result := append([]string{}, lines[:i]...)
+	result = append(result, text)
+	return strings.Join(append(result, lines[i:]...), "\n")
+}
+
+// SlurmEnviron returns a SLURM_* alias for every CRANE_* variable in env,
+// the same as SlurmEnvPrelude does in a job script.
+func SlurmEnviron(env []string) []string {
+	var aliases []string
+	for _, kv := range env {
+		name, val, ok := strings.Cut(kv, "=")
+		if !ok || !strings.HasPrefix(name, "CRANE_") {
+			continue
+		}
+		name = "SLURM_" + strings.TrimPrefix(name, "CRANE_")
+		aliases = append(aliases, name+"="+val)
+		switch name {
+		case "SLURM_JOB_ID":
+			aliases = append(aliases, "SLURM_JOBID="+val)
+		case "SLURM_JOB_NODELIST":
+			aliases = append(aliases, "SLURM_NODELIST="+val)
+		}
+	}
+	return aliases
+}
@@ -0,0 +1,61 @@
+/**
+ * Copyright (c) 2023 Peking University and Peking University
+ * Changsha Institute for Computing and Digital Economy
+ *
+ * CraneSched is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of
+ * the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS,
+ * WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+package slurm
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestInsertAfterDirectives(t *testing.T) {
+	tests := []struct {
+		script string
+		want   string
+	}{
+		{"#!/bin/bash\n#SBATCH -N 2\n\nhostname\n",
+			"#!/bin/bash\n#SBATCH -N 2\n\nPRELUDE\nhostname\n"},
+		{"hostname\n", "PRELUDE\nhostname\n"},
+		{"#!/bin/sh\n  # indented comment\n  echo hi\n",
+			"#!/bin/sh\n  # indented comment\nPRELUDE\n  echo hi\n"},
+		{"#!/bin/sh\n#SBATCH -N 2", "#!/bin/sh\n#SBATCH -N 2\nPRELUDE"},
+	}
+
+	for _, tt := range tests {
+		if got := InsertAfterDirectives(tt.script, "PRELUDE"); got != tt.want {
+			t.Errorf("InsertAfterDirectives(%q) = %q, want %q", tt.script, got, tt.want)
+		}
+	}
+}
+
+func TestSlurmEnviron(t *testing.T) {
+	tests := []struct {
+		env  []string
+		want []string
+	}{
+		{nil, nil},
+		{[]string{"PATH=/bin", "CRANE=x", "MY_CRANE_X=1"}, nil},
+		{[]string{"CRANE_JOB_ID=12", "CRANE_JOB_NODELIST=cn[01-02]", "CRANE_CPUS_PER_TASK=2", "CRANE_EMPTY="},
+			[]string{"SLURM_JOB_ID=12", "SLURM_JOBID=12",
+				"SLURM_JOB_NODELIST=cn[01-02]", "SLURM_NODELIST=cn[01-02]",
+				"SLURM_CPUS_PER_TASK=2", "SLURM_EMPTY="}},
+	}
+
+	for _, tt := range tests {
+		if got := SlurmEnviron(tt.env); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SlurmEnviron(%q) = %q, want %q", tt.env, got, tt.want)
+		}
+	}
+}
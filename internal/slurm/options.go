@@ -0,0 +1,91 @@
+/**
+ * Copyright (c) 2023 Peking University and Peking University
+ * Changsha Institute for Computing and Digital Economy
+ *
+ * CraneSched is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of
+ * the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS,
+ * WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package slurm
+
+import (
+	"fmt"
+	"os/user"
+	"strings"
+	"time"
+)
+
+// valueOpt maps a Slurm option with a value to the Crane option.
+func valueOpt(crane string, names ...string) Option {
+	return Option{names: names, hasValue: true, crane: crane}
+}
+
+// flagOpt maps a Slurm option without value to the Crane option.
+func flagOpt(crane string, names ...string) Option {
+	return Option{names: names, crane: crane}
+}
+
+// convertedOpt maps a Slurm option to the Crane option whose value
+// is in a different format.
+func convertedOpt(crane string, hasValue bool, convert func(string) (string, error), names ...string) Option {
+	return Option{names: names, hasValue: hasValue, crane: crane, convert: convert}
+}
+
+// unsupportedOpt is a Slurm option without Crane equivalent, which is
+// dropped with a warning.
+func unsupportedOpt(hasValue bool, names ...string) Option {
+	return Option{names: names, hasValue: hasValue}
+}
+
+// silentOpt is a Slurm option which makes no difference in Crane.
+func silentOpt(hasValue bool, names ...string) Option {
+	return Option{names: names, hasValue: hasValue, silent: true}
+}
+
+// currentUser converts --me into the name of the current user.
+func currentUser(string) (string, error) {
+	u, err := user.Current()
+	if err != nil {
+		return "", err
+	}
+	return u.Username, nil
+}
+
+// convertSlurmDate converts the date of sacct, e.g. 2023-10-01 or
+// 2023-10-01T08:00, into the format of util.ParseTime.
+func convertSlurmDate(val string) (string, error) {
+	switch {
+	case strings.EqualFold(val, "now"):
+		return time.Now().Format("2006-01-02T15:04:05"), nil
+	case len(val) == len("2006-01-02"):
+		return val + "T00:00:00", nil
+	case len(val) == len("2006-01-02T15:04"):
+		return val + ":00", nil
+	case len(val) == len("2006-01-02T15:04:05"):
+		return val, nil
+	}
+	return "", fmt.Errorf("expect YYYY-MM-DD[THH:MM[:SS]]")
+}
+
+// convertList converts every item of a comma separated list.
+func convertList(val string, convert func(string) (string, error)) (string, error) {
+	var items []string
+	for _, item := range strings.Split(val, ",") {
+		converted, err := convert(item)
+		if err != nil {
+			return "", err
+		}
+		if converted != "" {
+			items = append(items, converted)
+		}
+	}
+	return strings.Join(items, ","), nil
+}
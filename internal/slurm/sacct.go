@@ -0,0 +1,92 @@
+/**
+ * Copyright (c) 2023 Peking University and Peking University
+ * Changsha Institute for Computing and Digital Economy
+ *
+ * CraneSched is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of
+ * the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS,
+ * WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package slurm
+
+import (
+	"CraneFrontEnd/internal/cacct"
+	"fmt"
+	"strings"
+)
+
+var sacctCommand = &Command{
+	name: "sacct",
+	options: []Option{
+		valueOpt("--job", "-j", "--jobs"),
+		valueOpt("--user", "-u", "--user"),
+		valueOpt("--account", "-A", "--accounts"),
+		valueOpt("--name", "--name"),
+		convertedOpt("--start-time", true, func(val string) (string, error) {
+			date, err := convertSlurmDate(val)
+			return date + "~", err
+		}, "-S", "--starttime"),
+		convertedOpt("--end-time", true, func(val string) (string, error) {
+			date, err := convertSlurmDate(val)
+			return "~" + date, err
+		}, "-E", "--endtime"),
+		flagOpt("--noHeader", "-n", "--noheader"),
+		convertedOpt("--format", true, convertSacctFormat, "-o", "--format"),
+
+		unsupportedOpt(false, "-P", "--parsable2"),
+		unsupportedOpt(false, "-p", "--parsable"),
+		unsupportedOpt(true, "-s", "--state"),
+		unsupportedOpt(true, "-M", "--clusters"),
+		unsupportedOpt(true, "--units"),
+		unsupportedOpt(false, "-L", "--allclusters"),
+		unsupportedOpt(false, "-D", "--duplicates"),
+		// There are no job steps in Crane.
+		silentOpt(false, "-X", "--allocations"),
+		silentOpt(false, "-a", "--allusers"),
+		silentOpt(false, "-b", "--brief"),
+		silentOpt(false, "-l", "--long"),
+		silentOpt(false, "-v", "--verbose"),
+	},
+	run: func(parsed *ParsedArgs) {
+		if len(parsed.positional) > 0 {
+			Fatalf("sacct", "unexpected argument %s", parsed.positional[0])
+		}
+		runCrane("cacct", parsed.craneArgs, cacct.ParseCmdArgs)
+	},
+}
+
+func init() {
+	registerCommand(sacctCommand)
+}
+
+// sacctFields maps the field names of sacct --format to cacct's.
+var sacctFields = map[string]string{
+	"jobid": "TaskId", "jobidraw": "TaskId", "jobname": "TaskName",
+	"partition": "Partition", "account": "Account", "alloccpus": "AllocCPUs",
+	"state": "State", "exitcode": "ExitCode",
+}
+
+// convertSacctFormat converts sacct --format "JobID,JobName%30" into
+// cacct --format, keeping the widths.
+func convertSacctFormat(val string) (string, error) {
+	var fields []string
+	for _, item := range strings.Split(val, ",") {
+		name, width, hasWidth := strings.Cut(item, "%")
+		field, ok := sacctFields[strings.ToLower(name)]
+		if !ok {
+			return "", fmt.Errorf("field %s is not supported", name)
+		}
+		if hasWidth {
+			field += "%" + width
+		}
+		fields = append(fields, field)
+	}
+	return strings.Join(fields, ","), nil
+}
@@ -0,0 +1,68 @@
+/**
+ * Copyright (c) 2023 Peking University and Peking University
+ * Changsha Institute for Computing and Digital Economy
+ *
+ * CraneSched is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of
+ * the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS,
+ * WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package slurm
+
+import (
+	"CraneFrontEnd/internal/calloc"
+	"os"
+)
+
+var sallocCommand = &Command{
+	name: "salloc",
+	options: []Option{
+		valueOpt("--nodes", "-N", "--nodes"),
+		valueOpt("--cpus-per-task", "-c", "--cpus-per-task"),
+		valueOpt("--ntasks-per-node", "--ntasks-per-node"),
+		valueOpt("--time", "-t", "--time"),
+		valueOpt("--mem", "--mem"),
+		valueOpt("--partition", "-p", "--partition"),
+		valueOpt("--job-name", "-J", "--job-name"),
+		valueOpt("--account", "-A", "--account"),
+		valueOpt("--qos", "-q", "--qos"),
+		valueOpt("--chdir", "-D", "--chdir"),
+
+		unsupportedOpt(true, "-n", "--ntasks"),
+		unsupportedOpt(true, "-w", "--nodelist"),
+		unsupportedOpt(true, "-x", "--exclude"),
+		unsupportedOpt(true, "--gres"),
+		unsupportedOpt(true, "-C", "--constraint"),
+		unsupportedOpt(true, "--mem-per-cpu"),
+		unsupportedOpt(true, "--mail-type"),
+		unsupportedOpt(true, "--mail-user"),
+		unsupportedOpt(true, "--comment"),
+		unsupportedOpt(false, "--exclusive"),
+		silentOpt(false, "-Q", "--quiet"),
+		silentOpt(false, "-v", "--verbose"),
+	},
+	stopAtPositional: true,
+	run: func(parsed *ParsedArgs) {
+		args := parsed.craneArgs
+		if len(parsed.positional) > 0 {
+			args = append(append(args, "--"), parsed.positional...)
+		}
+		calloc.AllocationEnvironAliases = SlurmEnviron
+		runCrane("calloc", args, func() {
+			if err := calloc.CmdArgParser().Execute(); err != nil {
+				os.Exit(1)
+			}
+		})
+	},
+}
+
+func init() {
+	registerCommand(sallocCommand)
+}
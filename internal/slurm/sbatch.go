@@ -0,0 +1,124 @@
+/**
+ * Copyright (c) 2023 Peking University and Peking University
+ * Changsha Institute for Computing and Digital Economy
+ *
+ * CraneSched is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of
+ * the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS,
+ * WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package slurm
+
+import (
+	"CraneFrontEnd/internal/cbatch"
+	"io"
+	"os"
+	"strings"
+)
+
+var sbatchCommand = &Command{
+	name: "sbatch",
+	options: []Option{
+		valueOpt("--nodes", "-N", "--nodes"),
+		valueOpt("--cpus-per-task", "-c", "--cpus-per-task"),
+		valueOpt("--ntasks-per-node", "--ntasks-per-node"),
+		valueOpt("--time", "-t", "--time"),
+		valueOpt("--mem", "--mem"),
+		valueOpt("--partition", "-p", "--partition"),
+		valueOpt("--job-name", "-J", "--job-name"),
+		valueOpt("--account", "-A", "--account"),
+		valueOpt("--qos", "-q", "--qos"),
+		valueOpt("--chdir", "-D", "--chdir", "--workdir"),
+		valueOpt("--exclude", "-x", "--exclude"),
+		valueOpt("--nodelist", "-w", "--nodelist"),
+		convertedOpt("--get-user-env", false,
+			func(string) (string, error) { return "yes", nil }, "--get-user-env"),
+		valueOpt("--export", "--export"),
+		valueOpt("--output", "-o", "--output"),
+		valueOpt("--error", "-e", "--error"),
+		valueOpt("--array", "-a", "--array"),
+		valueOpt("--wrap", "--wrap"),
+		flagOpt("--wait", "-W", "--wait"),
+		flagOpt("--parsable", "--parsable"),
+		flagOpt("--test-only", "--test-only"),
+
+		unsupportedOpt(true, "-n", "--ntasks"),
+		unsupportedOpt(true, "--gres"),
+		unsupportedOpt(true, "-C", "--constraint"),
+		unsupportedOpt(true, "-d", "--dependency"),
+		unsupportedOpt(true, "--mem-per-cpu"),
+		unsupportedOpt(true, "--mail-type"),
+		unsupportedOpt(true, "--mail-user"),
+		unsupportedOpt(true, "--begin"),
+		unsupportedOpt(true, "--comment"),
+		unsupportedOpt(true, "--signal"),
+		unsupportedOpt(true, "--open-mode"),
+		unsupportedOpt(false, "--exclusive"),
+		unsupportedOpt(false, "--requeue"),
+		silentOpt(false, "--no-requeue"),
+		silentOpt(false, "-Q", "--quiet"),
+		silentOpt(false, "-v", "--verbose"),
+	},
+	stopAtPositional: true,
+	run:              runSbatch,
+}
+
+func init() {
+	registerCommand(sbatchCommand)
+}
+
+// runSbatch submits the job by cbatch. The script is passed to cbatch
+// through stdin after the Slurm compatible environment is inserted.
+func runSbatch(parsed *ParsedArgs) {
+	var script string
+	if wrap, ok := parsed.given["--wrap"]; ok {
+		if len(parsed.positional) > 0 {
+			Fatalf("sbatch", "a job script can't be given with --wrap")
+		}
+		script = "#!/bin/sh\n" + wrap + "\n"
+	} else {
+		var content []byte
+		var err error
+		if len(parsed.positional) == 0 || parsed.positional[0] == "-" {
+			content, err = io.ReadAll(os.Stdin)
+		} else {
+			content, err = os.ReadFile(parsed.positional[0])
+		}
+		if err != nil {
+			Fatalf("sbatch", "failed to read the job script: %s", err)
+		}
+		if len(parsed.positional) > 1 {
+			Fatalf("sbatch", "arguments of the job script are not supported")
+		}
+		script = string(content)
+	}
+	script = InsertAfterDirectives(script, SlurmEnvPrelude)
+
+	var args []string
+	for _, arg := range parsed.craneArgs {
+		if !strings.HasPrefix(arg, "--wrap=") {
+			args = append(args, arg)
+		}
+	}
+	args = append(args, "--translate-directives", "-")
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		Fatalf("sbatch", "failed to pass the job script to cbatch: %s", err)
+	}
+	go func() {
+		_, _ = io.WriteString(w, script)
+		_ = w.Close()
+	}()
+	os.Stdin = r
+
+	cbatch.SubmitMessageFormat = "Submitted batch job %d\n"
+	runCrane("cbatch", args, cbatch.ParseCmdArgs)
+}
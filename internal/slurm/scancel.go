@@ -0,0 +1,63 @@
+/**
+ * Copyright (c) 2023 Peking University and Peking University
+ * Changsha Institute for Computing and Digital Economy
+ *
+ * CraneSched is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of
+ * the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS,
+ * WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package slurm
+
+import (
+	"CraneFrontEnd/internal/ccancel"
+	"strings"
+)
+
+var scancelCommand = &Command{
+	name: "scancel",
+	options: []Option{
+		valueOpt("--name", "-n", "--name", "--jobname"),
+		valueOpt("--partition", "-p", "--partition"),
+		valueOpt("--state", "-t", "--state"),
+		valueOpt("--account", "-A", "--account"),
+		valueOpt("--user", "-u", "--user"),
+		convertedOpt("--user", false, currentUser, "--me"),
+		valueOpt("--nodes", "-w", "--nodelist"),
+
+		unsupportedOpt(true, "-s", "--signal"),
+		unsupportedOpt(true, "-M", "--clusters"),
+		unsupportedOpt(false, "-b", "--batch"),
+		unsupportedOpt(false, "-f", "--full"),
+		unsupportedOpt(false, "-i", "--interactive"),
+		silentOpt(false, "-Q", "--quiet"),
+		silentOpt(false, "-v", "--verbose"),
+	},
+	run: func(parsed *ParsedArgs) {
+		args := parsed.craneArgs
+		// scancel takes the job ids as separate arguments while ccancel
+		// takes a comma separated list.
+		var ids []string
+		for _, arg := range parsed.positional {
+			if strings.ContainsAny(arg, "_.") {
+				Fatalf("scancel", "job array elements and steps are not supported: %s", arg)
+			}
+			ids = append(ids, strings.Split(arg, ",")...)
+		}
+		if len(ids) > 0 {
+			args = append(args, strings.Join(ids, ","))
+		}
+		runCrane("ccancel", args, ccancel.ParseCmdArgs)
+	},
+}
+
+func init() {
+	registerCommand(scancelCommand)
+}
@@ -0,0 +1,73 @@
+/**
+ * Copyright (c) 2023 Peking University and Peking University
+ * Changsha Institute for Computing and Digital Economy
+ *
+ * CraneSched is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of
+ * the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS,
+ * WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package slurm
+
+import (
+	"CraneFrontEnd/internal/cinfo"
+	"fmt"
+	"strings"
+)
+
+var sinfoCommand = &Command{
+	name: "sinfo",
+	options: []Option{
+		valueOpt("--partition", "-p", "--partition"),
+		valueOpt("--nodes", "-n", "--nodes"),
+		convertedOpt("--states", true, convertSinfoStates, "-t", "--states"),
+		flagOpt("--dead", "-d", "--dead"),
+		flagOpt("--responding", "-r", "--responding"),
+		flagOpt("--summarize", "-s", "--summarize"),
+		valueOpt("--iterate", "-i", "--iterate"),
+
+		unsupportedOpt(true, "-o", "--format"),
+		unsupportedOpt(true, "-O", "--Format"),
+		unsupportedOpt(true, "-S", "--sort"),
+		unsupportedOpt(true, "-M", "--clusters"),
+		unsupportedOpt(false, "-h", "--noheader"),
+		unsupportedOpt(false, "-N", "--Node"),
+		silentOpt(false, "-l", "--long"),
+		silentOpt(false, "-e", "--exact"),
+		silentOpt(false, "-a", "--all"),
+		silentOpt(false, "-v", "--verbose"),
+	},
+	run: func(parsed *ParsedArgs) {
+		if len(parsed.positional) > 0 {
+			Fatalf("sinfo", "unexpected argument %s", parsed.positional[0])
+		}
+		runCrane("cinfo", parsed.craneArgs, cinfo.ParseCmdArgs)
+	},
+}
+
+func init() {
+	registerCommand(sinfoCommand)
+}
+
+func convertSinfoStates(val string) (string, error) {
+	return convertList(val, func(state string) (string, error) {
+		switch strings.ToLower(state) {
+		case "idle":
+			return "idle", nil
+		case "mix", "mixed":
+			return "mix", nil
+		case "alloc", "allocated":
+			return "alloc", nil
+		case "down":
+			return "down", nil
+		}
+		return "", fmt.Errorf("state %s is not supported", state)
+	})
+}
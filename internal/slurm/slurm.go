@@ -0,0 +1,223 @@
+/**
+ * Copyright (c) 2023 Peking University and Peking University
+ * Changsha Institute for Computing and Digital Economy
+ *
+ * CraneSched is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of
+ * the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS,
+ * WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package slurm
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Command is a Slurm command emulated by a Crane command.
+type Command struct {
+	name    string
+	options []Option
+	// Whether the options end at the first positional argument,
+	// like the script path of sbatch.
+	stopAtPositional bool
+	// run translates the parsed arguments and runs the Crane command.
+	run func(parsed *ParsedArgs)
+}
+
+// Option maps a Slurm option to the Crane one.
+type Option struct {
+	names    []string
+	hasValue bool
+	// crane is the name of the Crane option. If it is empty, the
+	// option is dropped with a warning.
+	crane string
+	// convert translates the value of the option if it is not nil.
+	// For an option without value, a non-empty result is passed as
+	// the value of the Crane option.
+	convert func(val string) (string, error)
+	// silent drops the option without any warning, for options which
+	// make no difference in Crane.
+	silent bool
+}
+
+// ParsedArgs holds the translated Crane options and the positional
+// arguments, keyed by the Crane option names.
+type ParsedArgs struct {
+	craneArgs  []string
+	given      map[string]string
+	positional []string
+}
+
+// Has returns whether the Slurm option mapped to the Crane option is given.
+func (p *ParsedArgs) Has(craneName string) bool {
+	_, ok := p.given[craneName]
+	return ok
+}
+
+var commands = map[string]*Command{}
+
+func registerCommand(cmd *Command) {
+	commands[cmd.name] = cmd
+}
+
+// Main emulates the Slurm command named by the name of the executable,
+// so that it can be installed as symbolic links like sbatch -> cslurm.
+// "cslurm sbatch ..." works as well.
+func Main() {
+	name := filepath.Base(os.Args[0])
+	args := os.Args[1:]
+	if _, ok := commands[name]; !ok {
+		if len(args) == 0 {
+			Fatalf("cslurm", "usage: cslurm {sbatch|squeue|scancel|sinfo|salloc|sacct} [options]")
+		}
+		name, args = args[0], args[1:]
+	}
+
+	cmd, ok := commands[name]
+	if !ok {
+		Fatalf("cslurm", "unsupported command %s", name)
+	}
+
+	parsed, err := parseArgs(cmd, args)
+	if err != nil {
+		Fatalf(name, "%s", err)
+	}
+	cmd.run(parsed)
+}
+
+func Warnf(name string, format string, a ...any) {
+	_, _ = fmt.Fprintf(os.Stderr, "%s: warning: %s\n", name, fmt.Sprintf(format, a...))
+}
+
+func Fatalf(name string, format string, a ...any) {
+	_, _ = fmt.Fprintf(os.Stderr, "%s: error: %s\n", name, fmt.Sprintf(format, a...))
+	os.Exit(1)
+}
+
+// runCrane runs the Crane command in this process with the translated
+// arguments. The Crane commands parse os.Args by cobra.
+func runCrane(craneName string, args []string, parse func()) {
+	os.Args = append([]string{craneName}, args...)
+	parse()
+}
+
+func (cmd *Command) lookup(name string) *Option {
+	for i := range cmd.options {
+		for _, n := range cmd.options[i].names {
+			if n == name {
+				return &cmd.options[i]
+			}
+		}
+	}
+	return nil
+}
+
+// parseArgs parses the Slurm style arguments of the command, accepting
+// "--opt=val", "--opt val", "-o val" and "-oval". Like getopt, short
+// options without value can be bundled, e.g. "-vv" or "-Qv".
+func parseArgs(cmd *Command, args []string) (*ParsedArgs, error) {
+	parsed := &ParsedArgs{given: make(map[string]string)}
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			parsed.positional = append(parsed.positional, args[i+1:]...)
+			break
+		}
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			if cmd.stopAtPositional {
+				parsed.positional = append(parsed.positional, args[i:]...)
+				break
+			}
+			parsed.positional = append(parsed.positional, arg)
+			continue
+		}
+
+		if strings.HasPrefix(arg, "--") {
+			name, val, hasVal := strings.Cut(arg, "=")
+			opt := cmd.lookup(name)
+			if opt == nil {
+				return nil, fmt.Errorf("unrecognized option '%s'", name)
+			}
+			if opt.hasValue && !hasVal {
+				if i+1 == len(args) {
+					return nil, fmt.Errorf("option '%s' requires an argument", name)
+				}
+				i++
+				val = args[i]
+			} else if !opt.hasValue && hasVal {
+				return nil, fmt.Errorf("option '%s' doesn't allow an argument", name)
+			}
+			if err := parsed.add(cmd, opt, name, val); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		// Short options, the last of which may take the rest as its value.
+		for j := 1; j < len(arg); j++ {
+			name := "-" + arg[j:j+1]
+			opt := cmd.lookup(name)
+			if opt == nil {
+				return nil, fmt.Errorf("unrecognized option '%s'", name)
+			}
+			if !opt.hasValue {
+				if err := parsed.add(cmd, opt, name, ""); err != nil {
+					return nil, err
+				}
+				continue
+			}
+
+			val := arg[j+1:]
+			if val == "" {
+				if i+1 == len(args) {
+					return nil, fmt.Errorf("option '%s' requires an argument", name)
+				}
+				i++
+				val = args[i]
+			}
+			if err := parsed.add(cmd, opt, name, val); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+
+	return parsed, nil
+}
+
+// add translates the option of the name given with the value.
+func (p *ParsedArgs) add(cmd *Command, opt *Option, name string, val string) error {
+	if opt.crane == "" {
+		if !opt.silent {
+			Warnf(cmd.name, "option %s is not supported by Crane and is ignored", name)
+		}
+		return nil
+	}
+
+	if opt.convert != nil {
+		converted, err := opt.convert(val)
+		if err != nil {
+			return fmt.Errorf("invalid value '%s' of option %s: %s", val, name, err)
+		}
+		val = converted
+	}
+
+	p.given[opt.crane] = val
+	if opt.hasValue || val != "" {
+		p.craneArgs = append(p.craneArgs, opt.crane+"="+val)
+	} else {
+		p.craneArgs = append(p.craneArgs, opt.crane)
+	}
+	return nil
+}
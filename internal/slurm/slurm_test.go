@@ -0,0 +1,123 @@
+/**
+ * Copyright (c) 2023 Peking University and Peking University
+ * Changsha Institute for Computing and Digital Economy
+ *
+ * CraneSched is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of
+ * the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS,
+ * WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+package slurm
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var testCommand = &Command{
+	name: "test",
+	options: []Option{
+		valueOpt("--nodes", "-N", "--nodes"),
+		valueOpt("--job-name", "-J", "--job-name"),
+		flagOpt("--parsable", "--parsable"),
+		flagOpt("--hold", "-H", "--hold"),
+		convertedOpt("--user", false, currentUser, "--me"),
+		unsupportedOpt(true, "--gres"),
+		silentOpt(false, "-Q", "--quiet"),
+		silentOpt(false, "-v", "--verbose"),
+	},
+}
+
+func TestParseArgs(t *testing.T) {
+	tests := []struct {
+		args           []string
+		stop           bool
+		wantCraneArgs  []string
+		wantPositional []string
+	}{
+		{[]string{"--nodes=2", "--job-name", "a b"}, false,
+			[]string{"--nodes=2", "--job-name=a b"}, nil},
+		{[]string{"-N", "2", "-Jjob"}, false,
+			[]string{"--nodes=2", "--job-name=job"}, nil},
+		{[]string{"--parsable", "-H"}, false,
+			[]string{"--parsable", "--hold"}, nil},
+		{[]string{"-vv", "-Qv", "-H"}, false,
+			[]string{"--hold"}, nil},
+		// Bundled flags followed by an option with a value
+		{[]string{"-vHN2"}, false,
+			[]string{"--hold", "--nodes=2"}, nil},
+		{[]string{"-vHN", "3"}, false,
+			[]string{"--hold", "--nodes=3"}, nil},
+		// The value of a short option may begin with the letters of flags.
+		{[]string{"-JvH"}, false,
+			[]string{"--job-name=vH"}, nil},
+		{[]string{"--gres=gpu:1", "-N", "1"}, false,
+			[]string{"--nodes=1"}, nil},
+		{[]string{"a", "-N", "1", "b"}, false,
+			[]string{"--nodes=1"}, []string{"a", "b"}},
+		{[]string{"-N", "1", "job.sh", "-N", "2"}, true,
+			[]string{"--nodes=1"}, []string{"job.sh", "-N", "2"}},
+		{[]string{"-H", "--", "-N", "2"}, false,
+			[]string{"--hold"}, []string{"-N", "2"}},
+		{[]string{"-", "-H"}, false,
+			[]string{"--hold"}, []string{"-"}},
+	}
+
+	for _, tt := range tests {
+		cmd := *testCommand
+		cmd.stopAtPositional = tt.stop
+		parsed, err := parseArgs(&cmd, tt.args)
+		if err != nil {
+			t.Errorf("parseArgs(%q) returned an error: %s", tt.args, err)
+			continue
+		}
+		if !reflect.DeepEqual(parsed.craneArgs, tt.wantCraneArgs) {
+			t.Errorf("parseArgs(%q).craneArgs = %q, want %q", tt.args, parsed.craneArgs, tt.wantCraneArgs)
+		}
+		if !reflect.DeepEqual(parsed.positional, tt.wantPositional) {
+			t.Errorf("parseArgs(%q).positional = %q, want %q", tt.args, parsed.positional, tt.wantPositional)
+		}
+	}
+}
+
+func TestParseArgsGiven(t *testing.T) {
+	parsed, err := parseArgs(testCommand, []string{"--me", "-N", "2"})
+	if err != nil {
+		t.Fatalf("parseArgs returned an error: %s", err)
+	}
+	if !parsed.Has("--user") || parsed.given["--user"] == "" {
+		t.Errorf("--me is not converted into --user: %v", parsed.given)
+	}
+	if parsed.given["--nodes"] != "2" || parsed.Has("--hold") {
+		t.Errorf("given = %v, want --nodes=2 and no --hold", parsed.given)
+	}
+}
+
+func TestParseArgsInvalid(t *testing.T) {
+	tests := []struct {
+		args    []string
+		wantErr string
+	}{
+		{[]string{"--frobnicate"}, "unrecognized option '--frobnicate'"},
+		{[]string{"-Z"}, "unrecognized option '-Z'"},
+		{[]string{"-vZ"}, "unrecognized option '-Z'"},
+		{[]string{"--nodes"}, "option '--nodes' requires an argument"},
+		{[]string{"-N"}, "option '-N' requires an argument"},
+		{[]string{"-vN"}, "option '-N' requires an argument"},
+		{[]string{"--parsable=yes"}, "option '--parsable' doesn't allow an argument"},
+	}
+
+	for _, tt := range tests {
+		_, err := parseArgs(testCommand, tt.args)
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("parseArgs(%q) returned %v, want an error with %q", tt.args, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+/**
+ * Copyright (c) 2023 Peking University and Peking University
+ * Changsha Institute for Computing and Digital Economy
+ *
+ * CraneSched is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of
+ * the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS,
+ * WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package slurm
+
+import (
+	"CraneFrontEnd/internal/cqueue"
+	"fmt"
+	"strings"
+)
+
+var squeueCommand = &Command{
+	name: "squeue",
+	options: []Option{
+		valueOpt("--job", "-j", "--jobs"),
+		valueOpt("--name", "-n", "--name"),
+		valueOpt("--partition", "-p", "--partition"),
+		valueOpt("--qos", "-q", "--qos"),
+		convertedOpt("--state", true, convertSqueueStates, "-t", "--states"),
+		valueOpt("--user", "-u", "--user"),
+		convertedOpt("--user", false, currentUser, "--me"),
+		valueOpt("--account", "-A", "--account"),
+		flagOpt("--noHeader", "-h", "--noheader"),
+		convertedOpt("--format", true, convertSqueueFormat, "-o", "--format"),
+		convertedOpt("--format", true, convertSqueueLongFormat, "-O", "--Format"),
+		valueOpt("--iterate", "-i", "--iterate"),
+
+		unsupportedOpt(true, "-w", "--nodelist"),
+		unsupportedOpt(true, "-S", "--sort"),
+		unsupportedOpt(true, "-M", "--clusters"),
+		silentOpt(false, "-a", "--all"),
+		silentOpt(false, "-l", "--long"),
+		silentOpt(false, "-r", "--array"),
+		silentOpt(false, "-v", "--verbose"),
+	},
+	run: func(parsed *ParsedArgs) {
+		if len(parsed.positional) > 0 {
+			Fatalf("squeue", "unexpected argument %s", parsed.positional[0])
+		}
+		runCrane("cqueue", parsed.craneArgs, cqueue.ParseCmdArgs)
+	},
+}
+
+func init() {
+	registerCommand(squeueCommand)
+}
+
+// squeueFields maps the field letters of squeue -o to those of cqueue.
+var squeueFields = map[byte]byte{
+	'i': 'j', 'A': 'j', 'j': 'n', 't': 't', 'T': 't', 'P': 'P',
+	'u': 'u', 'a': 'a', 'l': 'l', 'D': 'N', 'N': 'I', 'p': 'p',
+	'Q': 'p', 'q': 'q', 'V': 's',
+}
+
+// squeueLongFields maps the field names of squeue -O to the field
+// letters of cqueue.
+var squeueLongFields = map[string]byte{
+	"jobid": 'j', "jobarrayid": 'j', "name": 'n', "state": 't',
+	"statecompact": 't', "partition": 'P', "username": 'u', "account": 'a',
+	"timelimit": 'l', "numnodes": 'N', "nodelist": 'I', "priority": 'p',
+	"prioritylong": 'p', "qos": 'q', "submittime": 's',
+}
+
+// convertSqueueStates converts the job states of squeue into cqueue's.
+// cqueue shows the pending and running jobs for an empty list.
+func convertSqueueStates(val string) (string, error) {
+	if strings.EqualFold(val, "all") {
+		return "", nil
+	}
+	return convertList(val, func(state string) (string, error) {
+		switch strings.ToUpper(state) {
+		case "PD", "PENDING":
+			return "p", nil
+		case "R", "RUNNING":
+			return "r", nil
+		case "CA", "CANCELLED":
+			return "c", nil
+		case "TO", "TIMEOUT":
+			return "etl", nil
+		}
+		return "", fmt.Errorf("state %s is not supported", state)
+	})
+}
+
+// cqueueField formats a field of cqueue --format with an optional width.
+func cqueueField(field byte, width string) string {
+	if width == "" {
+		return "%" + string(field)
+	}
+	return "%." + width + string(field)
+}
+
+// convertSqueueFormat converts squeue -o "%.18i %.9P %j" into cqueue
+// --format. cqueue can't print literal text, which is dropped.
+func convertSqueueFormat(val string) (string, error) {
+	var fields []string
+	droppedText := false
+	for i := 0; i < len(val); i++ {
+		if val[i] != '%' {
+			if val[i] != ' ' && val[i] != '\t' {
+				droppedText = true
+			}
+			continue
+		}
+
+		j := i + 1
+		for j < len(val) && (val[j] == '.' || val[j] == '-') {
+			j++
+		}
+		widthBegin := j
+		for j < len(val) && val[j] >= '0' && val[j] <= '9' {
+			j++
+		}
+		if j == len(val) {
+			return "", fmt.Errorf("incomplete field at the end")
+		}
+		field, ok := squeueFields[val[j]]
+		if !ok {
+			return "", fmt.Errorf("field %%%c is not supported", val[j])
+		}
+		fields = append(fields, cqueueField(field, val[widthBegin:j]))
+		i = j
+	}
+
+	if droppedText {
+		Warnf("squeue", "literal text in the format is not supported and is ignored")
+	}
+	if len(fields) == 0 {
+		return "", fmt.Errorf("no field is given")
+	}
+	return strings.Join(fields, " "), nil
+}
+
+// convertSqueueLongFormat converts squeue -O "JobID:10,Name" into cqueue --format.
+func convertSqueueLongFormat(val string) (string, error) {
+	var fields []string
+	for _, item := range strings.Split(val, ",") {
+		name, width, _ := strings.Cut(item, ":")
+		field, ok := squeueLongFields[strings.ToLower(name)]
+		if !ok {
+			return "", fmt.Errorf("field %s is not supported", name)
+		}
+		fields = append(fields, cqueueField(field, strings.TrimPrefix(width, ".")))
+	}
+	return strings.Join(fields, " "), nil
+}
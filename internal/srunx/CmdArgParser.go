@@ -0,0 +1,89 @@
+/**
+ * Copyright (c) 2023 Peking University and Peking University
+ * Changsha Institute for Computing and Digital Economy
+ *
+ * CraneSched is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of
+ * the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS,
+ * WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package srunx
+
+import (
+	"CraneFrontEnd/internal/util"
+	"github.com/spf13/cobra"
+	"os"
+)
+
+var (
+	FlagTaskId    uint32
+	FlagNodelist  string
+	FlagNodes     uint32
+	FlagLabel     bool
+	FlagPty       bool
+	FlagMultiProg bool
+
+	FlagNtasksPerNode uint32
+	FlagMpi           string
+	FlagHostFileDir   string
+
+	// Only used when srunx is not in any allocation and requests a new one.
+	FlagResources util.ResourceFlags
+
+	FlagConfigFilePath string
+	FlagDebugLevel     string
+)
+
+func ParseCmdArgs() {
+	rootCmd := &cobra.Command{
+		Use:   "srunx [options] executable [args...]",
+		Short: "run a command in an allocated job",
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			main(cmd, args)
+		},
+	}
+
+	// Everything after the executable belongs to the executable itself.
+	rootCmd.Flags().SetInterspersed(false)
+
+	rootCmd.PersistentFlags().StringVarP(&FlagConfigFilePath, "config", "C",
+		util.DefaultConfigPath, "Path to configuration file")
+	rootCmd.PersistentFlags().StringVarP(&FlagDebugLevel, "debug-level", "D",
+		"info", "Output level")
+	rootCmd.Flags().Uint32VarP(&FlagTaskId, "job", "j", 0,
+		"id of the job to run in, default is the enclosing allocation")
+	rootCmd.Flags().StringVarP(&FlagNodelist, "nodelist", "w", "",
+		"nodes on which to run, default is $CRANE_JOB_NODELIST")
+	rootCmd.Flags().Uint32VarP(&FlagNodes, "nodes", "N", 0,
+		"number of nodes on which to run, default is all the nodes")
+	rootCmd.Flags().Uint32Var(&FlagNtasksPerNode, "ntasks-per-node", 0,
+		"number of tasks to invoke on each node, default is the tasks per node of the job")
+	rootCmd.Flags().StringVar(&FlagMpi, "mpi", "none",
+		"also set the environment variables of the MPI implementation: none, openmpi or mpich")
+	rootCmd.Flags().StringVar(&FlagHostFileDir, "hostfile-dir", "",
+		"directory shared by the nodes to hold the generated hostfile, default is the working directory")
+	rootCmd.Flags().BoolVarP(&FlagLabel, "label", "l", false,
+		"prepend rank number to lines of output")
+	rootCmd.Flags().BoolVar(&FlagPty, "pty", false,
+		"run the command in a pseudo-terminal on the first node")
+	rootCmd.Flags().BoolVar(&FlagMultiProg, "multi-prog", false,
+		"run different programs on different ranks, "+
+			"the executable is taken as the configuration file")
+
+	// Only used when srunx is not in any allocation and requests a new one.
+	// --nodes and --ntasks-per-node above are also used for the new job.
+	FlagResources.AddFlags(rootCmd, "cpus-per-task", "time", "mem",
+		"partition", "job-name", "account", "qos")
+
+	if err := rootCmd.Execute(); err != nil {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,396 @@
+/**
+ * Copyright (c) 2023 Peking University and Peking University
+ * Changsha Institute for Computing and Digital Economy
+ *
+ * CraneSched is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of
+ * the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS,
+ * WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package srunx
+
+import (
+	"CraneFrontEnd/generated/protos"
+	"CraneFrontEnd/internal/util"
+	"context"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// CforedAllocation is a job allocated by srunx itself through cfored.
+// It lives as long as the step and is released afterwards.
+type CforedAllocation struct {
+	taskId        uint32
+	cranedRegex   string
+	ntasksPerNode uint32
+
+	conn         *grpc.ClientConn
+	stream       protos.CraneForeD_CallocStreamClient
+	replyChannel chan CforedReplyReceiveItem
+
+	// Notified when CraneCtld cancels the allocation.
+	cancelChannel chan bool
+	// Receives the ack of the completion request or the broken connection.
+	ackChannel chan CforedReplyReceiveItem
+}
+
+type CforedReplyReceiveItem struct {
+	reply *protos.StreamCforedReply
+	err   error
+}
+
+func CforedReplyReceiveRoutine(stream protos.CraneForeD_CallocStreamClient,
+	replyChannel chan CforedReplyReceiveItem) {
+	for {
+		cforedReply, err := stream.Recv()
+		replyChannel <- CforedReplyReceiveItem{
+			reply: cforedReply,
+			err:   err,
+		}
+		if err != nil {
+			if err != io.EOF {
+				log.Debugf("Failed to receive CforedReply: %s. "+
+					"CforedReplyReceiveRoutine is exiting...", err)
+			}
+			break
+		}
+	}
+}
+
+func connectCfored() (*grpc.ClientConn, error) {
+	var opts []grpc.DialOption
+	opts = append(opts, grpc.WithTransportCredentials(insecure.NewCredentials()))
+
+	unixSocketPath := "unix:///" + util.DefaultCforedUnixSocketPath
+	return grpc.Dial(unixSocketPath, opts...)
+}
+
+// QueryTaskIdFromCfored asks the local cfored whether srunx is started by
+// a calloc. cfored walks up the process tree of srunx to find it out.
+func QueryTaskIdFromCfored() (uint32, bool) {
+	if _, err := os.Stat(util.DefaultCforedUnixSocketPath); err != nil {
+		log.Debugf("Cfored is not running: %s", err)
+		return 0, false
+	}
+
+	conn, err := connectCfored()
+	if err != nil {
+		log.Debugf("Failed to connect to cfored: %s", err)
+		return 0, false
+	}
+	defer func(conn *grpc.ClientConn) {
+		_ = conn.Close()
+	}(conn)
+
+	client := protos.NewCraneForeDClient(conn)
+	reply, err := client.QueryTaskIdFromPid(context.Background(),
+		&protos.QueryTaskIdFromPidRequest{Pid: int32(os.Getpid())})
+	if err != nil {
+		log.Debugf("Failed to query task id from cfored: %s", err)
+		return 0, false
+	}
+
+	return reply.TaskId, reply.Ok
+}
+
+// QueryNodelistOfTask asks CraneCtld for the nodes allocated to taskId.
+func QueryNodelistOfTask(taskId uint32) (string, error) {
+	stub := util.GetStubToCtldByConfig(gVars.config)
+	reply, err := stub.QueryTasksInfo(context.Background(),
+		&protos.QueryTasksInfoRequest{FilterTaskIds: []uint32{taskId}})
+	if err != nil {
+		return "", err
+	}
+
+	if !reply.Ok || len(reply.TaskInfoList) == 0 {
+		return "", fmt.Errorf("job #%d is not found", taskId)
+	}
+
+	taskInfo := reply.TaskInfoList[0]
+	if taskInfo.Status != protos.TaskStatus_Running {
+		return "", fmt.Errorf("job #%d is %s", taskId, taskInfo.Status.String())
+	}
+
+	return taskInfo.CranedList, nil
+}
+
+// FindAllocation finds the job in which srunx runs.
+// $CRANE_JOB_ID is checked at first. Then cfored is asked in case
+// srunx is started from a calloc shell.
+func FindAllocation() (uint32, bool) {
+	if jobIdStr, ok := os.LookupEnv("CRANE_JOB_ID"); ok {
+		id, err := strconv.ParseUint(jobIdStr, 10, 32)
+		if err != nil {
+			log.Fatalf("Invalid CRANE_JOB_ID: %s", jobIdStr)
+		}
+		log.Debugf("Job #%d found in CRANE_JOB_ID", id)
+		return uint32(id), true
+	}
+
+	if taskId, ok := QueryTaskIdFromCfored(); ok {
+		log.Debugf("Job #%d found by cfored", taskId)
+		return taskId, true
+	}
+
+	return 0, false
+}
+
+// BuildTaskToCtld builds the job requested by srunx when it doesn't
+// run inside any allocation.
+func BuildTaskToCtld(args []string) *protos.TaskToCtld {
+	cwd, err := os.Getwd()
+	if err != nil {
+		log.Fatalf("Failed to get working directory: %s", err)
+	}
+
+	task := util.NewTaskToCtld()
+	task.Name = filepath.Base(args[0])
+	task.Type = protos.TaskType_Interactive
+	task.Uid = uint32(os.Getuid())
+	task.Payload = &protos.TaskToCtld_InteractiveMeta{InteractiveMeta: nil}
+	task.CmdLine = strings.Join(os.Args, " ")
+	task.Cwd = cwd
+
+	if FlagNodes != 0 {
+		task.NodeNum = FlagNodes
+	}
+	if FlagNtasksPerNode != 0 {
+		task.NtasksPerNode = FlagNtasksPerNode
+	}
+	if err := FlagResources.Apply(task); err != nil {
+		log.Fatal(err)
+	}
+	if err := util.CheckResources(task); err != nil {
+		log.Fatal(err)
+	}
+
+	return task
+}
+
+// AllocateFromCfored requests a new job through cfored in the same way
+// as calloc does and blocks until the resource is allocated.
+func AllocateFromCfored(task *protos.TaskToCtld) (*CforedAllocation, error) {
+	conn, err := connectCfored()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to cfored: %s", err)
+	}
+
+	alloc := &CforedAllocation{
+		ntasksPerNode: task.NtasksPerNode,
+		conn:          conn,
+		replyChannel:  make(chan CforedReplyReceiveItem, 8),
+		cancelChannel: make(chan bool, 1),
+		ackChannel:    make(chan CforedReplyReceiveItem, 1),
+	}
+
+	client := protos.NewCraneForeDClient(conn)
+	alloc.stream, err = client.CallocStream(gVars.globalCtx)
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("failed to create CallocStream: %s", err)
+	}
+	go CforedReplyReceiveRoutine(alloc.stream, alloc.replyChannel)
+
+	request := &protos.StreamCallocRequest{
+		Type: protos.StreamCallocRequest_TASK_REQUEST,
+		Payload: &protos.StreamCallocRequest_PayloadTaskReq{
+			PayloadTaskReq: &protos.StreamCallocRequest_TaskReq{
+				Task:      task,
+				CallocPid: int32(os.Getpid()),
+			},
+		},
+	}
+	if err := alloc.stream.Send(request); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("failed to send task request to cfored: %s", err)
+	}
+
+	// The job is cancelled if srunx is interrupted before it is allocated.
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	defer signal.Stop(sigs)
+
+	var item CforedReplyReceiveItem
+	select {
+	case item = <-alloc.replyChannel:
+	case sig := <-sigs:
+		alloc.cancelPending()
+		return nil, fmt.Errorf("interrupted by %s before the job id is allocated", sig)
+	}
+	if item.err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("connection to cfored broken when requesting task id: %s", item.err)
+	}
+	if item.reply.Type != protos.StreamCforedReply_TASK_ID_REPLY {
+		log.Fatal("Expect type TASK_ID_REPLY")
+	}
+	taskIdReply := item.reply.GetPayloadTaskIdReply()
+	if !taskIdReply.Ok {
+		_ = conn.Close()
+		return nil, fmt.Errorf("failed to allocate task id: %s", taskIdReply.FailureReason)
+	}
+	alloc.taskId = taskIdReply.TaskId
+	_, _ = fmt.Fprintf(os.Stderr, "srunx: job %d queued and waiting for resources\n", alloc.taskId)
+
+	select {
+	case item = <-alloc.replyChannel:
+	case sig := <-sigs:
+		_, _ = fmt.Fprintf(os.Stderr, "srunx: cancelling job %d\n", alloc.taskId)
+		alloc.cancelPending()
+		return nil, fmt.Errorf("interrupted by %s before job #%d is allocated", sig, alloc.taskId)
+	}
+	if item.err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("connection to cfored broken when waiting resource allocated: %s", item.err)
+	}
+	switch item.reply.Type {
+	case protos.StreamCforedReply_TASK_RES_ALLOC_REPLY:
+		allocReply := item.reply.GetPayloadTaskAllocReply()
+		if !allocReply.Ok {
+			_ = conn.Close()
+			return nil, fmt.Errorf("failed to allocate resource of job #%d", alloc.taskId)
+		}
+		alloc.cranedRegex = allocReply.AllocatedCranedRegex
+
+	case protos.StreamCforedReply_TASK_CANCEL_REQUEST:
+		// Cancelled while pending. Cfored waits for the completion request.
+		go alloc.replyDispatchRoutine()
+		alloc.Release(protos.TaskStatus_Cancelled)
+		return nil, fmt.Errorf("job #%d was cancelled before resource allocated", alloc.taskId)
+
+	default:
+		log.Fatalf("Expect TASK_RES_ALLOC_REPLY. Received: %s", item.reply.Type.String())
+	}
+
+	_, _ = fmt.Fprintf(os.Stderr, "srunx: job %d has been allocated resources\n", alloc.taskId)
+
+	go alloc.replyDispatchRoutine()
+
+	return alloc, nil
+}
+
+// cancelPending cancels the job before it is allocated, whose id is 0 if
+// it is not known yet, and waits for cfored to acknowledge it.
+func (alloc *CforedAllocation) cancelPending() {
+	defer func(conn *grpc.ClientConn) {
+		_ = conn.Close()
+	}(alloc.conn)
+
+	request := &protos.StreamCallocRequest{
+		Type: protos.StreamCallocRequest_TASK_COMPLETION_REQUEST,
+		Payload: &protos.StreamCallocRequest_PayloadTaskCompleteReq{
+			PayloadTaskCompleteReq: &protos.StreamCallocRequest_TaskCompleteReq{
+				TaskId: alloc.taskId,
+				Status: protos.TaskStatus_Cancelled,
+			},
+		},
+	}
+	if err := alloc.stream.Send(request); err != nil {
+		log.Errorf("The connection to cfored was broken: %s.", err)
+		return
+	}
+
+	for {
+		item := <-alloc.replyChannel
+		if item.err != nil {
+			return
+		}
+		switch item.reply.Type {
+		case protos.StreamCforedReply_TASK_ID_REPLY:
+			// Crossed with the completion request. No job is created if not ok.
+			if !item.reply.GetPayloadTaskIdReply().Ok {
+				return
+			}
+		case protos.StreamCforedReply_TASK_RES_ALLOC_REPLY,
+			protos.StreamCforedReply_TASK_CANCEL_REQUEST:
+			// Crossed with the completion request.
+		case protos.StreamCforedReply_TASK_COMPLETION_ACK_REPLY:
+			return
+		default:
+			log.Fatalf("Expect TASK_COMPLETION_ACK_REPLY. Received: %s", item.reply.Type.String())
+		}
+	}
+}
+
+// replyDispatchRoutine is the only reader of the replies from cfored once
+// the resource is allocated. A cancel request from CraneCtld or a broken
+// connection is notified by cancelChannel. The ack of the completion request
+// is handed to Release by ackChannel.
+func (alloc *CforedAllocation) replyDispatchRoutine() {
+	for {
+		item := <-alloc.replyChannel
+		if item.err != nil {
+			log.Errorf("The connection to cfored was broken: %s.", item.err)
+			select {
+			case alloc.cancelChannel <- true:
+			default:
+			}
+			alloc.ackChannel <- item
+			return
+		}
+
+		switch item.reply.Type {
+		case protos.StreamCforedReply_TASK_CANCEL_REQUEST:
+			log.Debug("Received TASK_CANCEL_REQUEST")
+			select {
+			case alloc.cancelChannel <- true:
+			default:
+			}
+
+		case protos.StreamCforedReply_TASK_COMPLETION_ACK_REPLY:
+			alloc.ackChannel <- item
+			return
+
+		default:
+			log.Fatalf("Expect TASK_CANCEL_REQUEST or TASK_COMPLETION_ACK_REPLY. "+
+				"Received: %s", item.reply.Type.String())
+		}
+	}
+}
+
+// Release tells cfored that the job is finished and waits for the ack.
+func (alloc *CforedAllocation) Release(status protos.TaskStatus) {
+	defer func(conn *grpc.ClientConn) {
+		_ = conn.Close()
+	}(alloc.conn)
+
+	request := &protos.StreamCallocRequest{
+		Type: protos.StreamCallocRequest_TASK_COMPLETION_REQUEST,
+		Payload: &protos.StreamCallocRequest_PayloadTaskCompleteReq{
+			PayloadTaskCompleteReq: &protos.StreamCallocRequest_TaskCompleteReq{
+				TaskId: alloc.taskId,
+				Status: status,
+			},
+		},
+	}
+
+	log.Debugf("Sending TASK_COMPLETION_REQUEST with %s state...", status.String())
+	if err := alloc.stream.Send(request); err != nil {
+		log.Errorf("The connection to cfored was broken: %s.", err)
+		return
+	}
+
+	item := <-alloc.ackChannel
+	if item.err != nil {
+		return
+	}
+	if !item.reply.GetPayloadTaskCompletionAckReply().Ok {
+		log.Error("Failed to notify server of task completion")
+	}
+}
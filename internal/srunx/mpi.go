@@ -0,0 +1,95 @@
+/**
+ * Copyright (c) 2023 Peking University and Peking University
+ * Changsha Institute for Computing and Digital Economy
+ *
+ * CraneSched is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of
+ * the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS,
+ * WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package srunx
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// WriteHostFile writes the host of every rank, one rank per line,
+// into a new file in dir. Both OpenMPI and MPICH accept this format.
+// dir must be shared by the nodes, since every rank reads the file.
+func WriteHostFile(dir string, taskId uint32, ranks []*SrunXRank) (string, error) {
+	// The name is not predictable since dir may be shared, e.g. /tmp.
+	file, err := os.CreateTemp(dir, fmt.Sprintf("crane_hostfile.%d.*", taskId))
+	if err != nil {
+		return "", err
+	}
+
+	var content strings.Builder
+	for _, r := range ranks {
+		content.WriteString(r.cranedName)
+		content.WriteString("\n")
+	}
+
+	_, err = file.WriteString(content.String())
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(file.Name())
+		return "", err
+	}
+	return file.Name(), nil
+}
+
+// SetRankEnv fills the environment variables with which every rank
+// finds its place in the step.
+func SetRankEnv(ranks []*SrunXRank, cranedNames []string, ntasksPerNode int,
+	hostFilePath string, mpiType string) {
+	nprocs := strconv.Itoa(len(ranks))
+	localSize := strconv.Itoa(ntasksPerNode)
+	nodelist := strings.Join(cranedNames, ",")
+
+	for _, r := range ranks {
+		rank := strconv.Itoa(r.rank)
+		localId := strconv.Itoa(r.localId)
+		nodeId := strconv.Itoa(r.nodeId)
+
+		r.env = map[string]string{
+			"CRANE_JOB_ID":          strconv.FormatUint(uint64(r.taskId), 10),
+			"CRANE_PROCID":          rank,
+			"CRANE_NPROCS":          nprocs,
+			"CRANE_LOCALID":         localId,
+			"CRANE_NODEID":          nodeId,
+			"CRANE_NNODES":          strconv.Itoa(len(cranedNames)),
+			"CRANE_NODELIST":        nodelist,
+			"CRANE_NODENAME":        r.cranedName,
+			"CRANE_NTASKS_PER_NODE": localSize,
+			"CRANE_HOSTFILE":        hostFilePath,
+		}
+
+		switch mpiType {
+		case "openmpi":
+			r.env["OMPI_COMM_WORLD_RANK"] = rank
+			r.env["OMPI_COMM_WORLD_SIZE"] = nprocs
+			r.env["OMPI_COMM_WORLD_LOCAL_RANK"] = localId
+			r.env["OMPI_COMM_WORLD_LOCAL_SIZE"] = localSize
+			r.env["OMPI_COMM_WORLD_NODE_RANK"] = localId
+			r.env["OMPI_MCA_orte_default_hostfile"] = hostFilePath
+		case "mpich":
+			r.env["PMI_RANK"] = rank
+			r.env["PMI_SIZE"] = nprocs
+			r.env["MPI_LOCALRANKID"] = localId
+			r.env["MPI_LOCALNRANKS"] = localSize
+			r.env["HYDRA_HOST_FILE"] = hostFilePath
+		}
+	}
+}
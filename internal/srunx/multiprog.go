@@ -0,0 +1,200 @@
+/**
+ * Copyright (c) 2023 Peking University and Peking University
+ * Changsha Institute for Computing and Digital Economy
+ *
+ * CraneSched is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of
+ * the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS,
+ * WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package srunx
+
+import (
+	"CraneFrontEnd/internal/util"
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// MultiProgConfig is a parsed --multi-prog configuration file.
+//
+// Each line of the file is `<ranks> <executable> [args...]`, where <ranks> is
+// a comma separated list of ranks and rank ranges like `0,2-5`, or `*` for
+// all the ranks not given on the other lines.
+// In the command line, %t is replaced by the rank and %o by the offset of
+// the rank within the ranks of the line. Lines beginning with # are comments.
+type MultiProgConfig struct {
+	path  string
+	lines []multiProgLine
+}
+
+type multiProgLine struct {
+	lineNum int
+	// rankRanges is nil if the line is for all the remaining ranks.
+	rankRanges []rankRange
+	fields     []string
+}
+
+// ParseMultiProgFile parses a --multi-prog configuration file. It can be
+// parsed before the number of ranks is known, which is checked later by
+// ArgvOfRanks.
+func ParseMultiProgFile(path string) (*MultiProgConfig, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func(file *os.File) {
+		_ = file.Close()
+	}(file)
+
+	config := &MultiProgConfig{path: path}
+
+	scanner := bufio.NewScanner(file)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		words, err := util.SplitShellWords(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", path, lineNum, err)
+		}
+		var fields []string
+		for _, word := range words {
+			fields = append(fields, word.Text)
+		}
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("%s:%d: expect `<ranks> <executable> [args...]`",
+				path, lineNum)
+		}
+
+		rankRanges, err := parseRankList(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", path, lineNum, err)
+		}
+		config.lines = append(config.lines, multiProgLine{lineNum, rankRanges, fields[1:]})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(config.lines) == 0 {
+		return nil, fmt.Errorf("%s: no executable is given", path)
+	}
+
+	return config, nil
+}
+
+// ArgvOfRanks returns the command line of each of the numRanks ranks.
+// The lines of `*` take the ranks left by the other lines.
+func (c *MultiProgConfig) ArgvOfRanks(numRanks int) ([][]string, error) {
+	argvOfRanks := make([][]string, numRanks)
+	lineOfRanks := make([]int, numRanks)
+
+	setArgv := func(line *multiProgLine, ranks []int) {
+		for offset, rank := range ranks {
+			lineOfRanks[rank] = line.lineNum
+
+			argv := make([]string, len(line.fields))
+			for i, field := range line.fields {
+				field = strings.ReplaceAll(field, "%t", strconv.Itoa(rank))
+				field = strings.ReplaceAll(field, "%o", strconv.Itoa(offset))
+				argv[i] = field
+			}
+			argvOfRanks[rank] = argv
+		}
+	}
+
+	for i := range c.lines {
+		line := &c.lines[i]
+		if line.rankRanges == nil {
+			continue
+		}
+		var ranks []int
+		for _, r := range line.rankRanges {
+			if r.hi >= numRanks {
+				return nil, fmt.Errorf("%s:%d: rank %d is out of range, only %d ranks are launched",
+					c.path, line.lineNum, r.hi, numRanks)
+			}
+			for rank := r.lo; rank <= r.hi; rank++ {
+				if lineOfRanks[rank] != 0 {
+					return nil, fmt.Errorf("%s:%d: rank %d is already given at line %d",
+						c.path, line.lineNum, rank, lineOfRanks[rank])
+				}
+				ranks = append(ranks, rank)
+			}
+		}
+		setArgv(line, ranks)
+	}
+
+	starLineNum := 0
+	for i := range c.lines {
+		line := &c.lines[i]
+		if line.rankRanges != nil {
+			continue
+		}
+		if starLineNum != 0 {
+			return nil, fmt.Errorf("%s:%d: `*` is already given at line %d",
+				c.path, line.lineNum, starLineNum)
+		}
+		starLineNum = line.lineNum
+
+		var ranks []int
+		for rank := 0; rank < numRanks; rank++ {
+			if lineOfRanks[rank] == 0 {
+				ranks = append(ranks, rank)
+			}
+		}
+		setArgv(line, ranks)
+	}
+
+	for rank, argv := range argvOfRanks {
+		if argv == nil {
+			return nil, fmt.Errorf("%s: no executable is given for rank %d", c.path, rank)
+		}
+	}
+
+	return argvOfRanks, nil
+}
+
+type rankRange struct {
+	lo int
+	hi int
+}
+
+// parseRankList returns nil for `*`, which means all the remaining ranks.
+func parseRankList(rankList string) ([]rankRange, error) {
+	if rankList == "*" {
+		return nil, nil
+	}
+
+	var ranges []rankRange
+	for _, rangeStr := range strings.Split(rankList, ",") {
+		loStr, hiStr, isRange := strings.Cut(rangeStr, "-")
+		if !isRange {
+			hiStr = loStr
+		}
+		lo, err := strconv.Atoi(loStr)
+		if err != nil || lo < 0 {
+			return nil, fmt.Errorf("invalid rank range `%s`", rangeStr)
+		}
+		hi, err := strconv.Atoi(hiStr)
+		if err != nil || hi < lo {
+			return nil, fmt.Errorf("invalid rank range `%s`", rangeStr)
+		}
+		ranges = append(ranges, rankRange{lo, hi})
+	}
+
+	return ranges, nil
+}
@@ -0,0 +1,115 @@
+/**
+ * Copyright (c) 2023 Peking University and Peking University
+ * Changsha Institute for Computing and Digital Economy
+ *
+ * CraneSched is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of
+ * the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS,
+ * WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+package srunx
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeMultiProgFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "multi.conf")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestArgvOfRanks(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		numRanks int
+		want     [][]string
+	}{
+		{"all", "* ./a.out %t\n", 2,
+			[][]string{{"./a.out", "0"}, {"./a.out", "1"}}},
+		{"ranges", "# comment\n\n0 master\n1-2,4 worker %t %o\n3 'io node' \"x y\"\n", 5,
+			[][]string{{"master"}, {"worker", "1", "0"}, {"worker", "2", "1"},
+				{"io node", "x y"}, {"worker", "4", "2"}}},
+		{"star takes the remaining ranks", "* worker %t %o\n0,2 master %t\n", 4,
+			[][]string{{"master", "0"}, {"worker", "1", "0"}, {"master", "2"}, {"worker", "3", "1"}}},
+		{"star with no rank left", "0-1 a\n* b\n", 2,
+			[][]string{{"a"}, {"a"}}},
+		{"trailing comment", "0 a b # c\n", 1,
+			[][]string{{"a", "b"}}},
+	}
+
+	for _, tt := range tests {
+		config, err := ParseMultiProgFile(writeMultiProgFile(t, tt.content))
+		if err != nil {
+			t.Errorf("%s: ParseMultiProgFile returned an error: %s", tt.name, err)
+			continue
+		}
+		got, err := config.ArgvOfRanks(tt.numRanks)
+		if err != nil {
+			t.Errorf("%s: ArgvOfRanks(%d) returned an error: %s", tt.name, tt.numRanks, err)
+		} else if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: ArgvOfRanks(%d) = %v, want %v", tt.name, tt.numRanks, got, tt.want)
+		}
+	}
+}
+
+func TestParseMultiProgFileInvalid(t *testing.T) {
+	tests := []struct {
+		content string
+		wantErr string
+	}{
+		{"", "no executable is given"},
+		{"# only a comment\n", "no executable is given"},
+		{"0\n", "expect `<ranks> <executable> [args...]`"},
+		{"x a.out\n", "invalid rank range `x`"},
+		{"2-1 a.out\n", "invalid rank range `2-1`"},
+		{"-1 a.out\n", "invalid rank range `-1`"},
+		{"0 'a.out\n", "unterminated single quote"},
+	}
+
+	for _, tt := range tests {
+		_, err := ParseMultiProgFile(writeMultiProgFile(t, tt.content))
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("ParseMultiProgFile(%q) returned %v, want an error with %q", tt.content, err, tt.wantErr)
+		}
+	}
+}
+
+func TestArgvOfRanksInvalid(t *testing.T) {
+	tests := []struct {
+		content  string
+		numRanks int
+		wantErr  string
+	}{
+		{"0-3 a.out\n", 2, "rank 3 is out of range"},
+		{"0-1 a\n1 b\n", 2, "rank 1 is already given at line 1"},
+		{"0 a\n", 2, "no executable is given for rank 1"},
+		{"* a\n* b\n", 2, "`*` is already given at line 1"},
+	}
+
+	for _, tt := range tests {
+		config, err := ParseMultiProgFile(writeMultiProgFile(t, tt.content))
+		if err != nil {
+			t.Errorf("ParseMultiProgFile(%q) returned an error: %s", tt.content, err)
+			continue
+		}
+		_, err = config.ArgvOfRanks(tt.numRanks)
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("ArgvOfRanks(%d) of %q returned %v, want an error with %q",
+				tt.numRanks, tt.content, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,712 @@
+/**
+ * Copyright (c) 2023 Peking University and Peking University
+ * Changsha Institute for Computing and Digital Economy
+ *
+ * CraneSched is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of
+ * the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS,
+ * WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package srunx
+
+import (
+	"CraneFrontEnd/generated/protos"
+	"CraneFrontEnd/internal/util"
+	"CraneFrontEnd/internal/util/hostlist"
+	"context"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// SrunXProtocolVersion is the version of SrunXStream protocol
+// negotiated with Craned.
+const SrunXProtocolVersion uint32 = 1
+
+type GlobalVariables struct {
+	config *util.Config
+
+	globalCtx       context.Context
+	globalCtxCancel context.CancelFunc
+}
+
+var gVars GlobalVariables
+
+type StateOfSrunX int
+
+const (
+	ConnectCraned    StateOfSrunX = 0
+	Negotiate        StateOfSrunX = 1
+	CheckResource    StateOfSrunX = 2
+	SendExecInfo     StateOfSrunX = 3
+	TaskRunning      StateOfSrunX = 4
+	ConnectionBroken StateOfSrunX = 5
+)
+
+type ReplyReceiveItem struct {
+	reply *protos.SrunXStreamReply
+	err   error
+}
+
+func ReplyReceiveRoutine(stream protos.Craned_SrunXStreamClient,
+	replyChannel chan ReplyReceiveItem) {
+	for {
+		srunXReply, err := stream.Recv()
+		replyChannel <- ReplyReceiveItem{
+			reply: srunXReply,
+			err:   err,
+		}
+		if err != nil {
+			if err != io.EOF {
+				log.Debugf("Failed to receive SrunXStreamReply: %s. "+
+					"ReplyReceiveRoutine is exiting...", err)
+			}
+			break
+		}
+	}
+}
+
+// ExitCodeOfStatus converts the exit status of a remote process into
+// the exit code of srunx in the same way as a shell does.
+func ExitCodeOfStatus(status *protos.StreamReplyExitStatus) int {
+	if status.Reason == protos.StreamReplyExitStatus_Signal {
+		return 128 + int(status.Value)
+	}
+	return int(status.Value)
+}
+
+// SrunXRank is one process of the step. Each rank owns a SrunXStream
+// to the craned it runs on.
+type SrunXRank struct {
+	rank       int
+	nodeId     int
+	localId    int
+	cranedName string
+	taskId     uint32
+
+	execPath string
+	args     []string
+	env      map[string]string
+
+	// Signals to be forwarded to the remote process.
+	signalChannel chan int32
+
+	// Only used when the rank runs in a pseudo-terminal.
+	// Otherwise, they are nil and never selected.
+	pty               bool
+	stdinChannel      chan []byte
+	windowSizeChannel chan *protos.StreamRequestWindowSize
+}
+
+type RankOutputItem struct {
+	rank int
+	buf  string
+}
+
+type RankExitItem struct {
+	rank     int
+	exitCode int
+}
+
+// Signal asks the rank to forward signum to its remote process.
+// It never blocks. If too many signals are pending, signum is dropped.
+func (r *SrunXRank) Signal(signum int32) {
+	select {
+	case r.signalChannel <- signum:
+	default:
+		log.Debugf("Too many pending signals for rank %d. Signal %d is dropped.", r.rank, signum)
+	}
+}
+
+// StartSrunXStream runs the executable of the rank on its craned and
+// returns the exit code of the rank.
+func (r *SrunXRank) StartSrunXStream(outputChannel chan RankOutputItem) int {
+	client, conn, err := util.GetStubToCranedByConfig(gVars.config, r.cranedName)
+	if err != nil {
+		log.Errorf("[Rank %d] Failed to connect to craned %s: %s", r.rank, r.cranedName, err)
+		return 1
+	}
+	defer func() {
+		if err := conn.Close(); err != nil {
+			log.Debugf("[Rank %d] Failed to close grpc conn to craned %s: %s", r.rank, r.cranedName, err)
+		}
+	}()
+
+	var stream protos.Craned_SrunXStreamClient
+	var replyChannel chan ReplyReceiveItem
+	var request *protos.SrunXStreamRequest
+
+	exitCode := 1
+	state := ConnectCraned
+
+SrunXStateMachineLoop:
+	for {
+		switch state {
+		case ConnectCraned:
+			stream, err = client.SrunXStream(gVars.globalCtx)
+			if err != nil {
+				log.Errorf("[Rank %d] Failed to create SrunXStream to craned %s: %s.",
+					r.rank, r.cranedName, err)
+				break SrunXStateMachineLoop
+			}
+
+			replyChannel = make(chan ReplyReceiveItem, 8)
+			go ReplyReceiveRoutine(stream, replyChannel)
+
+			state = Negotiate
+
+		case Negotiate:
+			request = &protos.SrunXStreamRequest{
+				Type: protos.SrunXStreamRequest_NegotiationType,
+				Payload: &protos.SrunXStreamRequest_Negotiation{
+					Negotiation: &protos.StreamRequestNegotiation{
+						Version: SrunXProtocolVersion,
+					},
+				},
+			}
+			if err := stream.Send(request); err != nil {
+				log.Errorf("[Rank %d] Failed to send Negotiation to craned %s: %s.",
+					r.rank, r.cranedName, err)
+				state = ConnectionBroken
+				continue SrunXStateMachineLoop
+			}
+
+			ok, reason, broken := waitResult(replyChannel)
+			if broken {
+				state = ConnectionBroken
+			} else if !ok {
+				log.Errorf("[Rank %d] Craned %s refused protocol version %d: %s",
+					r.rank, r.cranedName, SrunXProtocolVersion, reason)
+				break SrunXStateMachineLoop
+			} else {
+				state = CheckResource
+			}
+
+		case CheckResource:
+			request = &protos.SrunXStreamRequest{
+				Type: protos.SrunXStreamRequest_CheckResourceType,
+				Payload: &protos.SrunXStreamRequest_CheckResource{
+					CheckResource: &protos.StreamRequestCheckResource{
+						TaskId: r.taskId,
+					},
+				},
+			}
+			if err := stream.Send(request); err != nil {
+				log.Errorf("[Rank %d] Failed to send CheckResource to craned %s: %s.",
+					r.rank, r.cranedName, err)
+				state = ConnectionBroken
+				continue SrunXStateMachineLoop
+			}
+
+			ok, reason, broken := waitResult(replyChannel)
+			if broken {
+				state = ConnectionBroken
+			} else if !ok {
+				log.Errorf("[Rank %d] Job #%d has no resource on craned %s: %s",
+					r.rank, r.taskId, r.cranedName, reason)
+				break SrunXStateMachineLoop
+			} else {
+				state = SendExecInfo
+			}
+
+		case SendExecInfo:
+			// Any signal received before the executable is started means
+			// the step is being torn down. Don't start it at all.
+			select {
+			case signum := <-r.signalChannel:
+				log.Debugf("[Rank %d] Signal %d received before execution. Aborting...",
+					r.rank, signum)
+				break SrunXStateMachineLoop
+			default:
+			}
+
+			request = &protos.SrunXStreamRequest{
+				Type: protos.SrunXStreamRequest_ExecutiveInfoType,
+				Payload: &protos.SrunXStreamRequest_ExecInfo{
+					ExecInfo: &protos.StreamRequestExecutiveInfo{
+						ExecutivePath: r.execPath,
+						Arguments:     r.args,
+						Pty:           r.pty,
+						Env:           r.env,
+					},
+				},
+			}
+			if err := stream.Send(request); err != nil {
+				log.Errorf("[Rank %d] Failed to send ExecutiveInfo to craned %s: %s.",
+					r.rank, r.cranedName, err)
+				state = ConnectionBroken
+				continue SrunXStateMachineLoop
+			}
+
+			if r.pty {
+				// Let the remote pseudo-terminal start with the size of ours.
+				if ws, err := GetWindowSize(); err == nil {
+					request = &protos.SrunXStreamRequest{
+						Type:    protos.SrunXStreamRequest_WindowSizeType,
+						Payload: &protos.SrunXStreamRequest_WindowSize{WindowSize: ws},
+					}
+					if err := stream.Send(request); err != nil {
+						log.Errorf("[Rank %d] Failed to send WindowSize to craned %s: %s.",
+							r.rank, r.cranedName, err)
+						state = ConnectionBroken
+						continue SrunXStateMachineLoop
+					}
+				}
+			}
+
+			state = TaskRunning
+
+		case TaskRunning:
+			select {
+			case signum := <-r.signalChannel:
+				request = &protos.SrunXStreamRequest{
+					Type:    protos.SrunXStreamRequest_SignalType,
+					Payload: &protos.SrunXStreamRequest_Signum{Signum: signum},
+				}
+				log.Tracef("[Rank %d] Forwarding signal %d", r.rank, signum)
+				if err := stream.Send(request); err != nil {
+					log.Errorf("[Rank %d] Failed to send Signal to craned %s: %s.",
+						r.rank, r.cranedName, err)
+					state = ConnectionBroken
+				}
+
+			case data := <-r.stdinChannel:
+				request = &protos.SrunXStreamRequest{
+					Type:    protos.SrunXStreamRequest_StdinType,
+					Payload: &protos.SrunXStreamRequest_Stdin{Stdin: data},
+				}
+				if err := stream.Send(request); err != nil {
+					log.Errorf("[Rank %d] Failed to send Stdin to craned %s: %s.",
+						r.rank, r.cranedName, err)
+					state = ConnectionBroken
+				}
+
+			case ws := <-r.windowSizeChannel:
+				request = &protos.SrunXStreamRequest{
+					Type:    protos.SrunXStreamRequest_WindowSizeType,
+					Payload: &protos.SrunXStreamRequest_WindowSize{WindowSize: ws},
+				}
+				log.Tracef("[Rank %d] Window size changed to %dx%d", r.rank, ws.Cols, ws.Rows)
+				if err := stream.Send(request); err != nil {
+					log.Errorf("[Rank %d] Failed to send WindowSize to craned %s: %s.",
+						r.rank, r.cranedName, err)
+					state = ConnectionBroken
+				}
+
+			case item := <-replyChannel:
+				srunXReply, err := item.reply, item.err
+				if err != nil {
+					state = ConnectionBroken
+					continue SrunXStateMachineLoop
+				}
+
+				switch srunXReply.Type {
+				case protos.SrunXStreamReply_IoRedirectionType:
+					outputChannel <- RankOutputItem{rank: r.rank, buf: srunXReply.GetIo().Buf}
+
+				case protos.SrunXStreamReply_ResultType:
+					// Craned reports whether the executable was started.
+					if !srunXReply.GetResult().Ok {
+						log.Errorf("[Rank %d] Failed to execute %s on craned %s: %s",
+							r.rank, r.execPath, r.cranedName, srunXReply.GetResult().Reason)
+						break SrunXStateMachineLoop
+					}
+
+				case protos.SrunXStreamReply_ExitStatusType:
+					exitStatus := srunXReply.GetExitStatus()
+					exitCode = ExitCodeOfStatus(exitStatus)
+					if exitStatus.Reason == protos.StreamReplyExitStatus_Signal {
+						log.Debugf("[Rank %d] Process on craned %s was killed by signal %d",
+							r.rank, r.cranedName, exitStatus.Value)
+					} else {
+						log.Debugf("[Rank %d] Process on craned %s exited with code %d",
+							r.rank, r.cranedName, exitStatus.Value)
+					}
+					break SrunXStateMachineLoop
+				}
+			}
+
+		case ConnectionBroken:
+			log.Errorf("[Rank %d] The connection to craned %s was broken. Exiting...",
+				r.rank, r.cranedName)
+			break SrunXStateMachineLoop
+		}
+	}
+
+	if stream != nil {
+		_ = stream.CloseSend()
+	}
+
+	return exitCode
+}
+
+// OutputRoutine merges the output of all ranks into out.
+// If label is set, every line is prefixed with the rank it comes from.
+func OutputRoutine(out io.Writer, outputChannel chan RankOutputItem, label bool, done chan bool) {
+	partialLines := make(map[int]string)
+
+	for item := range outputChannel {
+		if !label {
+			_, _ = io.WriteString(out, item.buf)
+			continue
+		}
+
+		buf := partialLines[item.rank] + item.buf
+		lines := strings.SplitAfter(buf, "\n")
+		// The last element is either empty or an incomplete line.
+		partialLines[item.rank] = lines[len(lines)-1]
+		for _, line := range lines[:len(lines)-1] {
+			_, _ = fmt.Fprintf(out, "%d: %s", item.rank, line)
+		}
+	}
+
+	ranks := make([]int, 0, len(partialLines))
+	for rank := range partialLines {
+		ranks = append(ranks, rank)
+	}
+	sort.Ints(ranks)
+	for _, rank := range ranks {
+		if line := partialLines[rank]; line != "" {
+			_, _ = fmt.Fprintf(out, "%d: %s\n", rank, line)
+		}
+	}
+
+	done <- true
+}
+
+// waitResult waits for a ResultType reply.
+// broken is set if the connection to craned was broken.
+func waitResult(replyChannel chan ReplyReceiveItem) (ok bool, reason string, broken bool) {
+	item := <-replyChannel
+	if item.err != nil {
+		return false, "", true
+	}
+
+	if item.reply.Type != protos.SrunXStreamReply_ResultType {
+		log.Fatalf("Expect type ResultType. Received: %s", item.reply.Type.String())
+	}
+
+	return item.reply.GetResult().Ok, item.reply.GetResult().Reason, false
+}
+
+// WaitAllRanks forwards signals received by srunx to all the ranks
+// and waits for every rank to exit. The exit code of the step is returned.
+// If cancelChannel is notified, the job is cancelled and the step is killed.
+func WaitAllRanks(ranks []*SrunXRank, exitChannel chan RankExitItem, cancelChannel chan bool) int {
+	sigs := make(chan os.Signal, 8)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT,
+		syscall.SIGUSR1, syscall.SIGUSR2)
+	defer signal.Stop(sigs)
+
+	var lastSigIntTime time.Time
+
+	// Once the user signals the step, the ranks are left to handle the
+	// signal on their own and a failed rank no longer kills the others.
+	stepSignalled := false
+
+	// Ranks killed by srunx itself don't contribute to the exit code.
+	// The exit code of the rank which made the step fail is reported instead.
+	exitCode := 0
+	killedRanks := make(map[int]bool)
+
+	for finished := 0; finished < len(ranks); {
+		select {
+		case sig := <-sigs:
+			signum := sig.(syscall.Signal)
+			if signum == syscall.SIGINT {
+				if time.Since(lastSigIntTime) < time.Second {
+					_, _ = fmt.Fprintln(os.Stderr, "srunx: killing the step...")
+					signum = syscall.SIGKILL
+				} else {
+					_, _ = fmt.Fprintln(os.Stderr,
+						"srunx: interrupt (one more within 1 sec to kill the step)")
+					lastSigIntTime = time.Now()
+				}
+			}
+
+			log.Debugf("Forwarding signal %s to all ranks", signum)
+			stepSignalled = true
+			for _, r := range ranks {
+				r.Signal(int32(signum))
+			}
+
+		case <-cancelChannel:
+			_, _ = fmt.Fprintln(os.Stderr, "srunx: job cancelled, killing the step...")
+			stepSignalled = true
+			for _, r := range ranks {
+				r.Signal(int32(syscall.SIGKILL))
+			}
+
+		case item := <-exitChannel:
+			finished++
+			if item.exitCode == 0 || killedRanks[item.rank] {
+				continue
+			}
+
+			_, _ = fmt.Fprintf(os.Stderr, "srunx: rank %d on %s exited with code %d\n",
+				item.rank, ranks[item.rank].cranedName, item.exitCode)
+			if item.exitCode > exitCode {
+				exitCode = item.exitCode
+			}
+
+			// One failed rank fails the whole step. Kill the others.
+			if !stepSignalled && len(killedRanks) == 0 {
+				for _, r := range ranks {
+					if r.rank != item.rank {
+						killedRanks[r.rank] = true
+						r.Signal(int32(syscall.SIGKILL))
+					}
+				}
+			}
+		}
+	}
+
+	return exitCode
+}
+
+// SetupRanks distributes the ranks of the step over the nodes of the job
+// and fills their environment. The path of the generated hostfile is
+// returned as well, to be removed once the step finishes.
+func SetupRanks(taskId uint32, alloc *CforedAllocation, args []string,
+	multiProg *MultiProgConfig) ([]*SrunXRank, string, error) {
+	var err error
+
+	nodelist := FlagNodelist
+	if nodelist == "" && alloc != nil {
+		nodelist = alloc.cranedRegex
+	}
+	if nodelist == "" && FlagTaskId == 0 {
+		nodelist = os.Getenv("CRANE_JOB_NODELIST")
+	}
+	if nodelist == "" {
+		if nodelist, err = QueryNodelistOfTask(taskId); err != nil {
+			return nil, "", fmt.Errorf("failed to get the nodes of the job: %w", err)
+		}
+	}
+	cranedNames, err := hostlist.Expand(nodelist)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid node list: %w", err)
+	}
+	if FlagNodes != 0 {
+		if int(FlagNodes) > len(cranedNames) {
+			return nil, "", fmt.Errorf("only %d nodes are allocated but --nodes=%d is requested",
+				len(cranedNames), FlagNodes)
+		}
+		cranedNames = cranedNames[:FlagNodes]
+	}
+
+	// The tasks per node of the job, or 0 if unknown. $CRANE_NTASKS_PER_NODE
+	// belongs to the enclosing allocation, which may not be the job of --job.
+	ntasksPerNode := 0
+	if alloc != nil {
+		ntasksPerNode = int(alloc.ntasksPerNode)
+	} else if ntasksStr, ok := os.LookupEnv("CRANE_NTASKS_PER_NODE"); ok && FlagTaskId == 0 {
+		ntasksPerNode, err = strconv.Atoi(ntasksStr)
+		if err != nil || ntasksPerNode <= 0 {
+			return nil, "", fmt.Errorf("invalid CRANE_NTASKS_PER_NODE: %s", ntasksStr)
+		}
+	}
+	if FlagNtasksPerNode != 0 {
+		if ntasksPerNode != 0 && int(FlagNtasksPerNode) > ntasksPerNode {
+			return nil, "", fmt.Errorf("the job has only %d tasks per node but --ntasks-per-node=%d is requested",
+				ntasksPerNode, FlagNtasksPerNode)
+		}
+		ntasksPerNode = int(FlagNtasksPerNode)
+	}
+	if ntasksPerNode == 0 {
+		ntasksPerNode = 1
+	}
+
+	if FlagPty {
+		if FlagNodes > 1 || FlagNtasksPerNode > 1 {
+			return nil, "", fmt.Errorf("--pty can only be used with one task")
+		}
+		cranedNames = cranedNames[:1]
+		ntasksPerNode = 1
+	}
+
+	// Ranks are distributed in block, i.e. rank 0 ~ ntasksPerNode-1 on the first node.
+	ranks := make([]*SrunXRank, 0, len(cranedNames)*ntasksPerNode)
+	for nodeId, cranedName := range cranedNames {
+		for localId := 0; localId < ntasksPerNode; localId++ {
+			ranks = append(ranks, &SrunXRank{
+				rank:          len(ranks),
+				nodeId:        nodeId,
+				localId:       localId,
+				cranedName:    cranedName,
+				taskId:        taskId,
+				execPath:      args[0],
+				args:          args[1:],
+				signalChannel: make(chan int32, 4),
+			})
+		}
+	}
+
+	if multiProg != nil {
+		argvOfRanks, err := multiProg.ArgvOfRanks(len(ranks))
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid multi-prog configuration: %w", err)
+		}
+		for i, r := range ranks {
+			r.execPath = argvOfRanks[i][0]
+			r.args = argvOfRanks[i][1:]
+		}
+	}
+
+	// The hostfile is read by the ranks on every node, so it is written
+	// into a directory shared by the nodes, by default the working directory.
+	hostFileDir := FlagHostFileDir
+	if hostFileDir == "" {
+		if hostFileDir, err = os.Getwd(); err != nil {
+			return nil, "", fmt.Errorf("failed to get working directory: %w", err)
+		}
+	}
+	hostFilePath, err := WriteHostFile(hostFileDir, taskId, ranks)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to write host file: %w", err)
+	}
+
+	SetRankEnv(ranks, cranedNames, ntasksPerNode, hostFilePath, FlagMpi)
+
+	return ranks, hostFilePath, nil
+}
+
+func main(cmd *cobra.Command, args []string) {
+	if layers, err := util.LoadSubmitDefaults("srunx"); err != nil {
+		log.Fatalf("Failed to load the defaults: %s", err)
+	} else if err := FlagResources.ApplyDefaults(layers); err != nil {
+		log.Fatalf("Failed to load the defaults: %s", err)
+	}
+
+	switch FlagDebugLevel {
+	case "trace":
+		util.InitLogger(log.TraceLevel)
+	case "debug":
+		util.InitLogger(log.DebugLevel)
+	case "info":
+		fallthrough
+	default:
+		util.InitLogger(log.InfoLevel)
+	}
+
+	log.Tracef("Positional args: %v\n", args)
+
+	gVars.globalCtx, gVars.globalCtxCancel = context.WithCancel(context.Background())
+	defer gVars.globalCtxCancel()
+
+	gVars.config = util.ParseConfig(FlagConfigFilePath)
+
+	var err error
+	var alloc *CforedAllocation
+
+	switch FlagMpi {
+	case "none", "openmpi", "mpich":
+	default:
+		log.Fatalf("Invalid --mpi: %s. Valid types are none, openmpi and mpich.", FlagMpi)
+	}
+
+	// The configuration is checked before any job is allocated for it.
+	var multiProg *MultiProgConfig
+	if FlagMultiProg {
+		if len(args) != 1 {
+			log.Fatal("--multi-prog expects exactly one configuration file.")
+		}
+		if multiProg, err = ParseMultiProgFile(args[0]); err != nil {
+			log.Fatalf("Invalid multi-prog configuration: %s", err)
+		}
+	}
+
+	taskId := FlagTaskId
+	if taskId == 0 {
+		var found bool
+		if taskId, found = FindAllocation(); !found {
+			log.Debug("No allocation found. Requesting a new one...")
+			if alloc, err = AllocateFromCfored(BuildTaskToCtld(args)); err != nil {
+				log.Fatalf("Failed to allocate resource: %s", err)
+			}
+			taskId = alloc.taskId
+		}
+	}
+
+	// A job allocated by srunx is released on every exit from here on.
+	ranks, hostFilePath, err := SetupRanks(taskId, alloc, args, multiProg)
+	if err != nil {
+		if alloc != nil {
+			alloc.Release(protos.TaskStatus_Cancelled)
+		}
+		log.Fatalf("Failed to set up the ranks of job #%d: %s", taskId, err)
+	}
+	log.RegisterExitHandler(func() { _ = os.Remove(hostFilePath) })
+
+	windowSizeRoutineDone := make(chan bool, 1)
+	stdinRoutineDone := make(chan bool)
+	if FlagPty {
+		r := ranks[0]
+		r.pty = true
+		r.stdinChannel = make(chan []byte, 8)
+		r.windowSizeChannel = make(chan *protos.StreamRequestWindowSize, 1)
+
+		if err := util.SetTerminalRaw(); err != nil {
+			if alloc != nil {
+				alloc.Release(protos.TaskStatus_Cancelled)
+			}
+			log.Fatalf("Failed to set the terminal to raw mode: %v", err)
+		}
+		go StdinRoutine(r, stdinRoutineDone)
+		go WindowSizeRoutine(r, windowSizeRoutineDone)
+	}
+
+	outputChannel := make(chan RankOutputItem, 64)
+	outputDone := make(chan bool, 1)
+	go OutputRoutine(os.Stdout, outputChannel, FlagLabel && !FlagPty, outputDone)
+
+	exitChannel := make(chan RankExitItem, len(ranks))
+	for _, r := range ranks {
+		go func(r *SrunXRank) {
+			exitChannel <- RankExitItem{rank: r.rank, exitCode: r.StartSrunXStream(outputChannel)}
+		}(r)
+	}
+
+	var cancelChannel chan bool
+	if alloc != nil {
+		cancelChannel = alloc.cancelChannel
+	}
+	exitCode := WaitAllRanks(ranks, exitChannel, cancelChannel)
+
+	close(outputChannel)
+	<-outputDone
+
+	close(stdinRoutineDone)
+	windowSizeRoutineDone <- true
+	util.RestoreTerminal()
+
+	if err := os.Remove(hostFilePath); err != nil {
+		log.Debugf("Failed to remove host file %s: %s", hostFilePath, err)
+	}
+
+	if alloc != nil {
+		if exitCode == 0 {
+			alloc.Release(protos.TaskStatus_Completed)
+		} else {
+			alloc.Release(protos.TaskStatus_Failed)
+		}
+	}
+
+	gVars.globalCtxCancel()
+	os.Exit(exitCode)
+}
@@ -0,0 +1,77 @@
+/**
+ * Copyright (c) 2023 Peking University and Peking University
+ * Changsha Institute for Computing and Digital Economy
+ *
+ * CraneSched is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of
+ * the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS,
+ * WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+package srunx
+
+import (
+	"CraneFrontEnd/generated/protos"
+	"strings"
+	"testing"
+)
+
+func TestExitCodeOfStatus(t *testing.T) {
+	tests := []struct {
+		reason protos.StreamReplyExitStatus_ExitReason
+		value  uint32
+		want   int
+	}{
+		{protos.StreamReplyExitStatus_Normal, 0, 0},
+		{protos.StreamReplyExitStatus_Normal, 3, 3},
+		{protos.StreamReplyExitStatus_Signal, 9, 137},
+		{protos.StreamReplyExitStatus_Signal, 2, 130},
+	}
+
+	for _, tt := range tests {
+		status := &protos.StreamReplyExitStatus{Reason: tt.reason, Value: tt.value}
+		if got := ExitCodeOfStatus(status); got != tt.want {
+			t.Errorf("ExitCodeOfStatus(%s, %d) = %d, want %d", tt.reason, tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestOutputRoutine(t *testing.T) {
+	tests := []struct {
+		name  string
+		items []RankOutputItem
+		label bool
+		want  string
+	}{
+		{"no label", []RankOutputItem{{0, "a"}, {1, "b\n"}, {0, "c\n"}}, false,
+			"ab\nc\n"},
+		{"whole lines", []RankOutputItem{{0, "a\nb\n"}, {1, "c\n"}}, true,
+			"0: a\n0: b\n1: c\n"},
+		{"lines split across outputs", []RankOutputItem{{0, "he"}, {1, "wor"}, {0, "llo\n"}, {1, "ld\n"}}, true,
+			"0: hello\n1: world\n"},
+		{"incomplete last lines", []RankOutputItem{{2, "x\ny"}, {1, "z"}}, true,
+			"2: x\n1: z\n2: y\n"},
+		{"empty lines", []RankOutputItem{{0, "\n\n"}}, true,
+			"0: \n0: \n"},
+	}
+
+	for _, tt := range tests {
+		var out strings.Builder
+		outputChannel := make(chan RankOutputItem, len(tt.items))
+		done := make(chan bool, 1)
+		for _, item := range tt.items {
+			outputChannel <- item
+		}
+		close(outputChannel)
+
+		OutputRoutine(&out, outputChannel, tt.label, done)
+		if got := out.String(); got != tt.want {
+			t.Errorf("%s: output = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
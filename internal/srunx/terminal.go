@@ -0,0 +1,106 @@
+/**
+ * Copyright (c) 2023 Peking University and Peking University
+ * Changsha Institute for Computing and Digital Economy
+ *
+ * CraneSched is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of
+ * the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS,
+ * WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package srunx
+
+import (
+	"CraneFrontEnd/generated/protos"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// StdinPollIntervalMs is how often StdinRoutine checks whether to exit
+// while nothing is typed.
+const StdinPollIntervalMs = 100
+
+// GetWindowSize returns the window size of the terminal of stdin.
+func GetWindowSize() (*protos.StreamRequestWindowSize, error) {
+	ws, err := unix.IoctlGetWinsize(int(os.Stdin.Fd()), unix.TIOCGWINSZ)
+	if err != nil {
+		return nil, err
+	}
+
+	return &protos.StreamRequestWindowSize{
+		Rows: uint32(ws.Row),
+		Cols: uint32(ws.Col),
+	}, nil
+}
+
+// StdinRoutine forwards everything typed on the terminal to the rank
+// until done is closed. Stdin is polled instead of read directly so that
+// the routine doesn't block in read(2) after the rank exits.
+func StdinRoutine(r *SrunXRank, done chan bool) {
+	fd := int(os.Stdin.Fd())
+	fds := []unix.PollFd{{Fd: int32(fd), Events: unix.POLLIN}}
+	buf := make([]byte, 4096)
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+
+		n, err := unix.Poll(fds, StdinPollIntervalMs)
+		if err == unix.EINTR || (err == nil && n == 0) {
+			continue
+		} else if err != nil {
+			log.Debugf("Failed to poll stdin: %v. StdinRoutine is exiting...", err)
+			return
+		}
+
+		n, err = unix.Read(fd, buf)
+		if err == unix.EINTR || err == unix.EAGAIN {
+			continue
+		} else if err != nil || n == 0 {
+			log.Tracef("Stdin closed: %v. StdinRoutine is exiting...", err)
+			return
+		}
+
+		data := make([]byte, n)
+		copy(data, buf[:n])
+		select {
+		case r.stdinChannel <- data:
+		case <-done:
+			return
+		}
+	}
+}
+
+// WindowSizeRoutine propagates every resize of the local terminal
+// to the pseudo-terminal of the rank.
+func WindowSizeRoutine(r *SrunXRank, done chan bool) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGWINCH)
+	defer signal.Stop(sigs)
+
+	for {
+		select {
+		case <-sigs:
+			ws, err := GetWindowSize()
+			if err != nil {
+				log.Debugf("Failed to get window size: %v", err)
+				continue
+			}
+			r.windowSizeChannel <- ws
+
+		case <-done:
+			return
+		}
+	}
+}
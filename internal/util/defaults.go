@@ -0,0 +1,196 @@
+/**
+ * Copyright (c) 2023 Peking University and Peking University
+ * Changsha Institute for Computing and Digital Economy
+ *
+ * CraneSched is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of
+ * the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS,
+ * WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package util
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	UserDefaultsFileName    = "defaults.yaml"
+	ProjectDefaultsFileName = ".crane.yaml"
+)
+
+// DefaultsLayer is a set of default option values of a submitting
+// command, keyed by the long option names without "--".
+type DefaultsLayer struct {
+	// Source describes where the values come from, e.g. the path of the file.
+	Source string
+	Values map[string]string
+}
+
+// LoadSubmitDefaults loads the defaults of the command from the user
+// file, the project file and the environment, in the ascending order
+// of precedence. The files look like
+//
+//	account: proj
+//	partition: CPU
+//	cbatch:
+//	  time: 01:00:00
+//
+// where the values under a command name only apply to that command.
+// Environment variables like CBATCH_ACCOUNT set --account of cbatch.
+func LoadSubmitDefaults(command string) ([]DefaultsLayer, error) {
+	layers, err := LoadDefaultsFiles(command)
+	if err != nil {
+		return nil, err
+	}
+	if envLayer := LoadDefaultsEnv(command); envLayer != nil {
+		layers = append(layers, *envLayer)
+	}
+	return layers, nil
+}
+
+// LoadDefaultsFiles loads the user file and then the project file.
+func LoadDefaultsFiles(command string) ([]DefaultsLayer, error) {
+	var layers []DefaultsLayer
+	files := []struct {
+		kind string
+		path string
+	}{
+		{"user defaults", userDefaultsPath()},
+		{"project defaults", projectDefaultsPath()},
+	}
+	for _, file := range files {
+		if file.path == "" {
+			continue
+		}
+		values, err := loadDefaultsFile(file.path, command)
+		if err != nil {
+			return nil, err
+		}
+		if values != nil {
+			layers = append(layers, DefaultsLayer{Source: file.kind + " " + file.path, Values: values})
+		}
+	}
+	return layers, nil
+}
+
+// LoadDefaultsEnv returns nil if no such environment variable is set.
+func LoadDefaultsEnv(command string) *DefaultsLayer {
+	envPrefix := strings.ToUpper(command) + "_"
+	values := make(map[string]string)
+	for _, env := range os.Environ() {
+		name, value, _ := strings.Cut(env, "=")
+		if strings.HasPrefix(name, envPrefix) && len(name) > len(envPrefix) {
+			option := strings.ReplaceAll(strings.ToLower(name[len(envPrefix):]), "_", "-")
+			values[option] = value
+		}
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	return &DefaultsLayer{Source: "environment " + envPrefix + "*", Values: values}
+}
+
+func userDefaultsPath() string {
+	configDir := os.Getenv("XDG_CONFIG_HOME")
+	if configDir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		configDir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(configDir, "crane", UserDefaultsFileName)
+}
+
+// projectDefaultsPath finds the project file by walking up from the
+// working directory. An empty string is returned if there is none.
+func projectDefaultsPath() string {
+	dir, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	for {
+		path := filepath.Join(dir, ProjectDefaultsFileName)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// loadDefaultsFile returns nil if the file doesn't exist.
+func loadDefaultsFile(path string, command string) (map[string]string, error) {
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var file map[string]any
+	if err := yaml.Unmarshal(content, &file); err != nil {
+		return nil, fmt.Errorf("invalid defaults file %s: %s", path, err)
+	}
+
+	values := make(map[string]string)
+	var commandValues map[any]any
+	for k, v := range file {
+		if section, ok := v.(map[any]any); ok {
+			if k == command {
+				commandValues = section
+			}
+			continue
+		}
+		values[k] = fmt.Sprint(v)
+	}
+	// Values of the command override the common ones.
+	for k, v := range commandValues {
+		values[fmt.Sprint(k)] = fmt.Sprint(v)
+	}
+	return values, nil
+}
+
+// ApplyDefaults sets the resource options which are not given on the
+// command line from the layers, where the later layer wins. Only the
+// options added by AddFlags are set, so that the defaults can't change
+// other flags of the command like --job or --config, and the others are
+// ignored since the files are shared by commands. The flags set are
+// marked as changed like the ones on the command line, so that they are
+// applied to the task.
+func (f *ResourceFlags) ApplyDefaults(layers []DefaultsLayer) error {
+	type defaultValue struct {
+		value  string
+		source string
+	}
+	merged := make(map[string]defaultValue)
+	for _, layer := range layers {
+		for option, value := range layer.Values {
+			merged[option] = defaultValue{value, layer.Source}
+		}
+	}
+
+	for option, v := range merged {
+		if !containsName(f.names, option) || f.cmd.Flags().Changed(option) {
+			continue
+		}
+		if err := f.cmd.Flags().Set(option, v.value); err != nil {
+			return fmt.Errorf("invalid %s of %s in %s: %s", v.value, option, v.source, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+/**
+ * Copyright (c) 2023 Peking University and Peking University
+ * Changsha Institute for Computing and Digital Economy
+ *
+ * CraneSched is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of
+ * the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS,
+ * WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package util
+
+import (
+	"github.com/spf13/cobra"
+	"testing"
+)
+
+func newResourceCommand(t *testing.T, args ...string) (*cobra.Command, *ResourceFlags) {
+	cmd := &cobra.Command{Use: "test"}
+	flags := &ResourceFlags{}
+	flags.AddFlags(cmd)
+	if err := cmd.ParseFlags(args); err != nil {
+		t.Fatalf("ParseFlags(%v): %s", args, err)
+	}
+	return cmd, flags
+}
+
+func TestApplyDefaults(t *testing.T) {
+	t.Setenv("TEST_PARTITION", "GPU")
+	t.Setenv("TEST_NTASKS_PER_NODE", "4")
+
+	layers := []DefaultsLayer{
+		{Source: "user", Values: map[string]string{
+			"partition": "CPU",
+			"account":   "proj",
+			"time":      "1:00:00",
+			"mem":       "2G",
+			"unknown":   "ignored",
+		}},
+		{Source: "project", Values: map[string]string{
+			"account": "lab",
+			"nodes":   "2",
+		}},
+	}
+	if envLayer := LoadDefaultsEnv("test"); envLayer != nil {
+		layers = append(layers, *envLayer)
+	} else {
+		t.Fatal("LoadDefaultsEnv returned nil")
+	}
+
+	// The command line wins over every layer.
+	_, flags := newResourceCommand(t, "--nodes", "3", "-J", "job")
+	if err := flags.ApplyDefaults(layers); err != nil {
+		t.Fatalf("ApplyDefaults: %s", err)
+	}
+
+	task := NewTaskToCtld()
+	if err := flags.Apply(task); err != nil {
+		t.Fatalf("Apply: %s", err)
+	}
+	if err := CheckResources(task); err != nil {
+		t.Fatalf("CheckResources: %s", err)
+	}
+
+	if task.PartitionName != "GPU" {
+		t.Errorf("PartitionName = %q, want %q", task.PartitionName, "GPU")
+	}
+	if task.Account != "lab" {
+		t.Errorf("Account = %q, want %q", task.Account, "lab")
+	}
+	if task.NodeNum != 3 {
+		t.Errorf("NodeNum = %d, want 3", task.NodeNum)
+	}
+	if task.Name != "job" {
+		t.Errorf("Name = %q, want %q", task.Name, "job")
+	}
+	if task.NtasksPerNode != 4 {
+		t.Errorf("NtasksPerNode = %d, want 4", task.NtasksPerNode)
+	}
+	if task.TimeLimit.Seconds != 3600 {
+		t.Errorf("TimeLimit = %ds, want 3600s", task.TimeLimit.Seconds)
+	}
+	if task.Resources.AllocatableResource.MemoryLimitBytes != 2<<30 {
+		t.Errorf("MemoryLimitBytes = %d, want %d",
+			task.Resources.AllocatableResource.MemoryLimitBytes, 2<<30)
+	}
+	if task.Resources.AllocatableResource.CpuCoreLimit != 4 {
+		t.Errorf("CpuCoreLimit = %v, want 4", task.Resources.AllocatableResource.CpuCoreLimit)
+	}
+	if !flags.Changed("partition") {
+		t.Error("partition set by the defaults is not changed")
+	}
+}
+
+func TestApplyDefaultsInvalid(t *testing.T) {
+	_, flags := newResourceCommand(t)
+	layers := []DefaultsLayer{{Source: "user", Values: map[string]string{"nodes": "many"}}}
+	if err := flags.ApplyDefaults(layers); err == nil {
+		t.Error("ApplyDefaults accepted an invalid --nodes")
+	}
+}
+
+func TestApplyDefaultsOnlyResourceOptions(t *testing.T) {
+	cmd := &cobra.Command{Use: "test"}
+	job := cmd.Flags().Uint32("job", 0, "")
+	flags := &ResourceFlags{}
+	flags.AddFlags(cmd, "partition")
+	if err := cmd.ParseFlags(nil); err != nil {
+		t.Fatalf("ParseFlags: %s", err)
+	}
+
+	layers := []DefaultsLayer{{Source: "user", Values: map[string]string{
+		"job":       "42",
+		"account":   "proj",
+		"partition": "CPU",
+	}}}
+	if err := flags.ApplyDefaults(layers); err != nil {
+		t.Fatalf("ApplyDefaults: %s", err)
+	}
+
+	if *job != 0 || cmd.Flags().Changed("job") {
+		t.Errorf("--job = %d is set by the defaults", *job)
+	}
+	if cmd.Flags().Lookup("account") != nil {
+		t.Error("--account is added although it is not requested")
+	}
+	if !flags.Changed("partition") {
+		t.Error("partition is not set by the defaults")
+	}
+}
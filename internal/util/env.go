@@ -0,0 +1,88 @@
+/**
+ * Copyright (c) 2023 Peking University and Peking University
+ * Changsha Institute for Computing and Digital Economy
+ *
+ * CraneSched is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of
+ * the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS,
+ * WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+package util
+
+import (
+	"CraneFrontEnd/generated/protos"
+	"os"
+	"strings"
+)
+
+func SplitEnvironEntry(env *string) (string, string) {
+	eq := strings.IndexByte(*env, '=')
+	if eq == -1 {
+		return *env, ""
+	} else {
+		return (*env)[:eq], (*env)[eq+1:]
+	}
+}
+
+// SetPropagatedEnviron sets the environment of the task according to
+// the value of --export carried in CRANE_EXPORT_ENV, which is ALL if
+// it's not given. The CRANE_* variables are always propagated.
+func SetPropagatedEnviron(task *protos.TaskToCtld) {
+	systemEnv := make(map[string]string)
+	for _, str := range os.Environ() {
+		name, value := SplitEnvironEntry(&str)
+		systemEnv[name] = value
+
+		// The CRANE_* environment variables are loaded anyway.
+		if strings.HasPrefix(name, "CRANE_") {
+			task.Env[name] = value
+		}
+	}
+
+	// This value is used only to carry the value of --export flag.
+	// Delete it once we get it.
+	valueOfExportFlag, haveExportFlag := task.Env["CRANE_EXPORT_ENV"]
+	if haveExportFlag {
+		delete(task.Env, "CRANE_EXPORT_ENV")
+	} else {
+		// Default mode is ALL
+		valueOfExportFlag = "ALL"
+	}
+
+	switch valueOfExportFlag {
+	case "NIL":
+	case "NONE":
+		task.GetUserEnv = true
+	case "ALL":
+		task.Env = systemEnv
+
+	default:
+		// The case like "ALL,A=a,B=b", "NIL,C=c"
+		task.GetUserEnv = true
+		splitValueOfExportFlag := strings.Split(valueOfExportFlag, ",")
+		for _, exportValue := range splitValueOfExportFlag {
+			if exportValue == "ALL" {
+				for k, v := range systemEnv {
+					task.Env[k] = v
+				}
+			} else {
+				k, v := SplitEnvironEntry(&exportValue)
+				// If user-specified value is empty, use system value instead.
+				if v != "" {
+					task.Env[k] = v
+				} else {
+					systemEnvValue, envExist := systemEnv[k]
+					if envExist {
+						task.Env[k] = systemEnvValue
+					}
+				}
+			}
+		}
+	}
+}
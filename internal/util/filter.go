@@ -0,0 +1,116 @@
+/**
+ * Copyright (c) 2023 Peking University and Peking University
+ * Changsha Institute for Computing and Digital Economy
+ *
+ * CraneSched is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of
+ * the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS,
+ * WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package util
+
+import (
+	"CraneFrontEnd/generated/protos"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/encoding/protojson"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const DefaultSubmitFilterTimeoutSec = 10
+
+// SubmitFilterWaitDelay is how long to wait for the output of a filter
+// after it is killed, in case its children keep the pipes open.
+const SubmitFilterWaitDelay = 2 * time.Second
+
+// SubmitFilterConfig is an external executable run on every job before
+// it's submitted. It reads the job as JSON from stdin, with the field
+// names in the proto as in the output of cbatch --test-only. On success, it
+// exits with 0 and prints the modified job as JSON, or nothing if the
+// job is unchanged. Otherwise, the job is rejected and stderr is shown
+// to the user.
+type SubmitFilterConfig struct {
+	Path       string   `yaml:"Path"`
+	Args       []string `yaml:"Args"`
+	TimeoutSec uint32   `yaml:"Timeout"`
+}
+
+// RunSubmitFilters passes the task through the filters in the config
+// in order. command is the name of the submitting command, which is
+// exported to the filters as CRANE_SUBMIT_COMMAND.
+func RunSubmitFilters(config *Config, command string, task *protos.TaskToCtld) (*protos.TaskToCtld, error) {
+	for _, filter := range config.SubmitFilters {
+		var err error
+		if task, err = runSubmitFilter(filter, command, task); err != nil {
+			return nil, err
+		}
+	}
+	return task, nil
+}
+
+func runSubmitFilter(filter SubmitFilterConfig, command string, task *protos.TaskToCtld) (*protos.TaskToCtld, error) {
+	input, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(task)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal the job for filter %s: %s", filter.Path, err)
+	}
+
+	timeout := time.Duration(filter.TimeoutSec) * time.Second
+	if filter.TimeoutSec == 0 {
+		timeout = DefaultSubmitFilterTimeoutSec * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, filter.Path, filter.Args...)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.Env = append(os.Environ(), "CRANE_SUBMIT_COMMAND="+command)
+	// Kill the filter together with its children on timeout.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = SubmitFilterWaitDelay
+
+	log.Debugf("Running submit filter %s", filter.Path)
+	err = cmd.Run()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return nil, fmt.Errorf("submit filter %s timed out after %s", filter.Path, timeout)
+	}
+	if err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return nil, fmt.Errorf("failed to run submit filter %s: %s", filter.Path, err)
+		}
+		reason := strings.TrimSpace(stderr.String())
+		if reason == "" {
+			reason = fmt.Sprintf("rejected by submit filter %s", filter.Path)
+		}
+		return nil, fmt.Errorf("%s", reason)
+	}
+
+	if len(bytes.TrimSpace(stdout.Bytes())) == 0 {
+		return task, nil
+	}
+	filtered := new(protos.TaskToCtld)
+	if err := protojson.Unmarshal(stdout.Bytes(), filtered); err != nil {
+		return nil, fmt.Errorf("invalid job returned by submit filter %s: %s", filter.Path, err)
+	}
+	return filtered, nil
+}
@@ -0,0 +1,72 @@
+/**
+ * Copyright (c) 2023 Peking University and Peking University
+ * Changsha Institute for Computing and Digital Economy
+ *
+ * CraneSched is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of
+ * the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS,
+ * WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package util
+
+import (
+	"CraneFrontEnd/generated/protos"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeFilter(t *testing.T, script string) string {
+	path := filepath.Join(t.TempDir(), "filter.sh")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0700); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRunSubmitFilterProtoNames(t *testing.T) {
+	// The filter sees the proto field names and renames the job.
+	filter := writeFilter(t, `grep -q '"partition_name":"CPU"' || exit 1
+echo '{"name": "filtered", "partition_name": "GPU"}'
+`)
+	task := NewTaskToCtld()
+	task.PartitionName = "CPU"
+
+	filtered, err := runSubmitFilter(SubmitFilterConfig{Path: filter}, "cbatch", task)
+	if err != nil {
+		t.Fatalf("runSubmitFilter: %s", err)
+	}
+	if filtered.Name != "filtered" || filtered.PartitionName != "GPU" {
+		t.Errorf("filtered job = %v, want name filtered and partition GPU", filtered)
+	}
+}
+
+func TestRunSubmitFilterReject(t *testing.T) {
+	filter := writeFilter(t, "echo 'no account given' >&2\nexit 1\n")
+	_, err := runSubmitFilter(SubmitFilterConfig{Path: filter}, "cbatch", &protos.TaskToCtld{})
+	if err == nil || err.Error() != "no account given" {
+		t.Errorf("runSubmitFilter error = %v, want the stderr of the filter", err)
+	}
+}
+
+func TestRunSubmitFilterTimeout(t *testing.T) {
+	// The child keeps stdout open after the filter is killed.
+	filter := writeFilter(t, "sleep 60 &\nsleep 60\n")
+	start := time.Now()
+	_, err := runSubmitFilter(SubmitFilterConfig{Path: filter, TimeoutSec: 1}, "cbatch", &protos.TaskToCtld{})
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("runSubmitFilter error = %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 1*time.Second+SubmitFilterWaitDelay+time.Second {
+		t.Errorf("runSubmitFilter returned after %s", elapsed)
+	}
+}
@@ -89,48 +89,51 @@ func GetListenSocketByConfig(config *Config) (net.Listener, error) {
 	}
 }
 
-func GetStubToCtldByConfig(config *Config) protos.CraneCtldClient {
-	var serverAddr string
-	var stub protos.CraneCtldClient
+func getClientTlsCredentialsByConfig(config *Config) credentials.TransportCredentials {
+	ServerCertContent, err := os.ReadFile(config.ServerCertFilePath)
+	if err != nil {
+		log.Fatal("Read server certificate error: " + err.Error())
+	}
 
-	if config.UseTls {
-		serverAddr = fmt.Sprintf("%s.%s:%s",
-			config.ControlMachine, config.DomainSuffix, config.CraneCtldListenPort)
+	ServerKeyContent, err := os.ReadFile(config.ServerKeyFilePath)
+	if err != nil {
+		log.Fatal("Read server key error: " + err.Error())
+	}
 
-		ServerCertContent, err := os.ReadFile(config.ServerCertFilePath)
-		if err != nil {
-			log.Fatal("Read server certificate error: " + err.Error())
-		}
+	CaCertContent, err := os.ReadFile(config.CaCertFilePath)
+	if err != nil {
+		log.Fatal("Read CA certifacate error: " + err.Error())
+	}
 
-		ServerKeyContent, err := os.ReadFile(config.ServerKeyFilePath)
-		if err != nil {
-			log.Fatal("Read server key error: " + err.Error())
-		}
+	tlsKeyPair, err := tls.X509KeyPair(ServerCertContent, ServerKeyContent)
+	if err != nil {
+		log.Fatal("tlsKeyPair error: " + err.Error())
+	}
 
-		CaCertContent, err := os.ReadFile(config.CaCertFilePath)
-		if err != nil {
-			log.Fatal("Read CA certifacate error: " + err.Error())
-		}
+	caPool := x509.NewCertPool()
+	if ok := caPool.AppendCertsFromPEM(CaCertContent); !ok {
+		log.Fatal("AppendCertsFromPEM error: " + err.Error())
+	}
 
-		tlsKeyPair, err := tls.X509KeyPair(ServerCertContent, ServerKeyContent)
-		if err != nil {
-			log.Fatal("tlsKeyPair error: " + err.Error())
-		}
+	return credentials.NewTLS(&tls.Config{
+		Certificates:       []tls.Certificate{tlsKeyPair},
+		RootCAs:            caPool,
+		InsecureSkipVerify: false,
+		// NextProtos is a list of supported application level protocols, in
+		// order of preference.
+		NextProtos: []string{"h2"},
+	})
+}
 
-		caPool := x509.NewCertPool()
-		if ok := caPool.AppendCertsFromPEM(CaCertContent); !ok {
-			log.Fatal("AppendCertsFromPEM error: " + err.Error())
-		}
+func GetStubToCtldByConfig(config *Config) protos.CraneCtldClient {
+	var serverAddr string
+	var stub protos.CraneCtldClient
 
-		creds := credentials.NewTLS(&tls.Config{
-			Certificates:       []tls.Certificate{tlsKeyPair},
-			RootCAs:            caPool,
-			InsecureSkipVerify: false,
-			// NextProtos is a list of supported application level protocols, in
-			// order of preference.
-			NextProtos: []string{"h2"},
-		})
+	if config.UseTls {
+		serverAddr = fmt.Sprintf("%s.%s:%s",
+			config.ControlMachine, config.DomainSuffix, config.CraneCtldListenPort)
 
+		creds := getClientTlsCredentialsByConfig(config)
 		conn, err := grpc.Dial(serverAddr, grpc.WithTransportCredentials(creds))
 		if err != nil {
 			log.Fatal("Cannot connect to CraneCtld: " + err.Error())
@@ -150,3 +153,33 @@ func GetStubToCtldByConfig(config *Config) protos.CraneCtldClient {
 
 	return stub
 }
+
+// GetStubToCranedByConfig connects to the Craned running on cranedName.
+// The connection is returned as well so that the caller can close it
+// once the stream on it is finished.
+func GetStubToCranedByConfig(config *Config, cranedName string) (protos.CranedClient, *grpc.ClientConn, error) {
+	var serverAddr string
+	var conn *grpc.ClientConn
+	var err error
+
+	cranedPort := config.CranedListenPort
+	if cranedPort == "" {
+		cranedPort = DefaultCranedListenPort
+	}
+
+	if config.UseTls {
+		serverAddr = fmt.Sprintf("%s.%s:%s", cranedName, config.DomainSuffix, cranedPort)
+
+		creds := getClientTlsCredentialsByConfig(config)
+		conn, err = grpc.Dial(serverAddr, grpc.WithTransportCredentials(creds))
+	} else {
+		serverAddr = fmt.Sprintf("%s:%s", cranedName, cranedPort)
+
+		conn, err = grpc.Dial(serverAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return protos.NewCranedClient(conn), conn, nil
+}
@@ -0,0 +1,230 @@
+/**
+ * Copyright (c) 2023 Peking University and Peking University
+ * Changsha Institute for Computing and Digital Economy
+ *
+ * CraneSched is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of
+ * the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS,
+ * WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+// Package hostlist expands and compresses host list expressions such as
+// "cn[001-016,020],gpu[1-4]", the format of the node lists in the replies
+// of CraneCtld and of the node options given by users.
+package hostlist
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MaxHosts bounds the number of hosts an expression may expand to, so that
+// a typo like cn[1-1000000000] doesn't exhaust the memory.
+const MaxHosts = 1 << 20
+
+// Expand expands a host list expression such as "cn[01-03,05],login"
+// into the names of all the hosts it contains, in the order they appear.
+// Zero-padding of the lower bound of a range is kept, e.g. cn[001-010].
+func Expand(hostList string) ([]string, error) {
+	var hosts []string
+
+	depth := 0
+	begin := 0
+	for i := 0; i <= len(hostList); i++ {
+		if i < len(hostList) {
+			switch hostList[i] {
+			case '[':
+				depth++
+				continue
+			case ']':
+				depth--
+				if depth < 0 {
+					return nil, fmt.Errorf("unbalanced ']' in host list %s", hostList)
+				}
+				continue
+			case ',':
+				if depth > 0 {
+					continue
+				}
+			default:
+				continue
+			}
+		}
+
+		if depth != 0 {
+			return nil, fmt.Errorf("unbalanced '[' in host list %s", hostList)
+		}
+		expr := strings.TrimSpace(hostList[begin:i])
+		if expr == "" {
+			return nil, fmt.Errorf("empty host name in host list %s", hostList)
+		}
+		expanded, err := expandHostExpr(expr, MaxHosts-len(hosts))
+		if err != nil {
+			return nil, err
+		}
+		hosts = append(hosts, expanded...)
+		begin = i + 1
+	}
+
+	return hosts, nil
+}
+
+// expandHostExpr expands a single host expression without top-level commas,
+// which may contain several brackets like "rack[1-2]-cn[01-04]".
+func expandHostExpr(expr string, limit int) ([]string, error) {
+	l := strings.IndexByte(expr, '[')
+	if l == -1 {
+		if strings.IndexByte(expr, ']') != -1 {
+			return nil, fmt.Errorf("invalid host expression %s", expr)
+		}
+		if limit < 1 {
+			return nil, fmt.Errorf("host list has more than %d hosts", MaxHosts)
+		}
+		return []string{expr}, nil
+	}
+	r := strings.IndexByte(expr, ']')
+	if r < l || strings.IndexByte(expr[l+1:r], '[') != -1 {
+		return nil, fmt.Errorf("invalid host expression %s", expr)
+	}
+
+	prefix := expr[:l]
+	suffixes, err := expandHostExpr(expr[r+1:], limit)
+	if err != nil {
+		return nil, err
+	}
+
+	var hosts []string
+	for _, rangeStr := range strings.Split(expr[l+1:r], ",") {
+		loStr, hiStr, isRange := strings.Cut(rangeStr, "-")
+		if !isRange {
+			hiStr = loStr
+		}
+		lo, err := parseIndex(loStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid range %s in host expression %s", rangeStr, expr)
+		}
+		hi, err := parseIndex(hiStr)
+		if err != nil || hi < lo {
+			return nil, fmt.Errorf("invalid range %s in host expression %s", rangeStr, expr)
+		}
+		if (hi-lo+1)*uint64(len(suffixes)) > uint64(limit-len(hosts)) {
+			return nil, fmt.Errorf("host expression %s has more than %d hosts", expr, MaxHosts)
+		}
+
+		for i := lo; i <= hi; i++ {
+			for _, suffix := range suffixes {
+				hosts = append(hosts, fmt.Sprintf("%s%0*d%s", prefix, len(loStr), i, suffix))
+			}
+		}
+	}
+
+	return hosts, nil
+}
+
+func parseIndex(s string) (uint64, error) {
+	// Only plain digits are accepted, since the length of the text is
+	// also the width of the zero-padding.
+	if s == "" || strings.TrimLeft(s, "0123456789") != "" {
+		return 0, fmt.Errorf("invalid index %q", s)
+	}
+	return strconv.ParseUint(s, 10, 32)
+}
+
+// hostName is a host name split into a prefix and a numeric suffix.
+// Host names without a numeric suffix have an empty digits.
+type hostName struct {
+	prefix string
+	digits string
+	index  uint64
+}
+
+func splitHostName(name string) hostName {
+	i := len(name)
+	for i > 0 && name[i-1] >= '0' && name[i-1] <= '9' {
+		i--
+	}
+	h := hostName{prefix: name[:i], digits: name[i:]}
+	if h.digits != "" {
+		index, err := strconv.ParseUint(h.digits, 10, 32)
+		if err != nil {
+			// Too many digits to be an index, keep the name as it is.
+			return hostName{prefix: name}
+		}
+		h.index = index
+	}
+	return h
+}
+
+// Compress compresses host names into a host list expression, e.g.
+// cn001, cn002, cn003 and cn005 into "cn[001-003,005]". The hosts are
+// sorted and duplicates removed, so that Expand(Compress(hosts)) returns
+// the sorted set of hosts.
+func Compress(hosts []string) string {
+	names := make([]hostName, 0, len(hosts))
+	for _, host := range hosts {
+		names = append(names, splitHostName(host))
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if names[i].prefix != names[j].prefix {
+			return names[i].prefix < names[j].prefix
+		}
+		if names[i].index != names[j].index {
+			return names[i].index < names[j].index
+		}
+		return len(names[i].digits) < len(names[j].digits)
+	})
+
+	var groups []string
+	for i := 0; i < len(names); {
+		prefix := names[i].prefix
+		if names[i].digits == "" {
+			groups = append(groups, prefix)
+			for i < len(names) && names[i].prefix == prefix && names[i].digits == "" {
+				i++
+			}
+			continue
+		}
+
+		var ranges []string
+		for i < len(names) && names[i].prefix == prefix {
+			lo := names[i]
+			hi := lo
+			i++
+			for i < len(names) && names[i].prefix == prefix {
+				next := names[i]
+				if next.digits == hi.digits {
+					// Duplicate
+					i++
+					continue
+				}
+				if next.index != hi.index+1 ||
+					fmt.Sprintf("%0*d", len(lo.digits), next.index) != next.digits {
+					break
+				}
+				hi = next
+				i++
+			}
+
+			if lo.digits == hi.digits {
+				ranges = append(ranges, lo.digits)
+			} else {
+				ranges = append(ranges, lo.digits+"-"+hi.digits)
+			}
+		}
+
+		if len(ranges) == 1 && !strings.Contains(ranges[0], "-") {
+			groups = append(groups, prefix+ranges[0])
+		} else {
+			groups = append(groups, prefix+"["+strings.Join(ranges, ",")+"]")
+		}
+	}
+
+	return strings.Join(groups, ",")
+}
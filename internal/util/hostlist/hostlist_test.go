@@ -0,0 +1,172 @@
+/**
+ * Copyright (c) 2023 Peking University and Peking University
+ * Changsha Institute for Computing and Digital Economy
+ *
+ * CraneSched is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of
+ * the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS,
+ * WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package hostlist
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestExpand(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"cn1", []string{"cn1"}},
+		{"cn1,login", []string{"cn1", "login"}},
+		{" cn1 , cn2 ", []string{"cn1", "cn2"}},
+		{"cn[1-3]", []string{"cn1", "cn2", "cn3"}},
+		{"cn[1-2,5]", []string{"cn1", "cn2", "cn5"}},
+		{"cn[3]", []string{"cn3"}},
+		// Zero padding follows the lower bound.
+		{"cn[01-03]", []string{"cn01", "cn02", "cn03"}},
+		{"cn[008-011]", []string{"cn008", "cn009", "cn010", "cn011"}},
+		{"cn[9-10]", []string{"cn9", "cn10"}},
+		{"cn[098-100]", []string{"cn098", "cn099", "cn100"}},
+		// Nested ranges
+		{"rack[1-2]-cn[01-02]", []string{"rack1-cn01", "rack1-cn02", "rack2-cn01", "rack2-cn02"}},
+		{"r[1,3]n[1-2]s", []string{"r1n1s", "r1n2s", "r3n1s", "r3n2s"}},
+		{"cn[1-2],gpu[01-02],login", []string{"cn1", "cn2", "gpu01", "gpu02", "login"}},
+	}
+
+	for _, tt := range tests {
+		got, err := Expand(tt.in)
+		if err != nil {
+			t.Errorf("Expand(%q) returned an error: %s", tt.in, err)
+		} else if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Expand(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestExpandInvalid(t *testing.T) {
+	tests := []string{
+		"",
+		"cn1,,cn2",
+		"cn[1-3",
+		"cn1-3]",
+		"cn[[1-3]]",
+		"cn[]",
+		"cn[3-1]",
+		"cn[a-b]",
+		"cn[1-]",
+		"cn[-1]",
+		"cn[+1]",
+		"cn[1-2-3]",
+		"cn[99999999999]",
+	}
+
+	for _, in := range tests {
+		if got, err := Expand(in); err == nil {
+			t.Errorf("Expand(%q) = %v, want an error", in, got)
+		}
+	}
+}
+
+func TestExpandMaxHosts(t *testing.T) {
+	hosts, err := Expand("cn[1-1048576]")
+	if err != nil {
+		t.Fatalf("Expand of MaxHosts hosts returned an error: %s", err)
+	}
+	if len(hosts) != MaxHosts {
+		t.Errorf("Expand of MaxHosts hosts returned %d hosts", len(hosts))
+	}
+
+	tests := []string{
+		"cn[1-1048577]",
+		"cn[0-4000000000]",
+		"r[1-1024]n[1-1025]",
+		"cn[1-1048576],login",
+		"a[1-524288],b[1-524289]",
+	}
+	for _, in := range tests {
+		if _, err := Expand(in); err == nil {
+			t.Errorf("Expand(%q) returned more than MaxHosts hosts", in)
+		}
+	}
+}
+
+func TestCompress(t *testing.T) {
+	tests := []struct {
+		in   []string
+		want string
+	}{
+		{nil, ""},
+		{[]string{"cn1"}, "cn1"},
+		{[]string{"login"}, "login"},
+		{[]string{"cn3", "cn1", "cn2", "cn5"}, "cn[1-3,5]"},
+		{[]string{"cn1", "cn1", "cn2"}, "cn[1-2]"},
+		{[]string{"cn001", "cn002", "cn003", "cn005"}, "cn[001-003,005]"},
+		{[]string{"cn9", "cn10"}, "cn[9-10]"},
+		{[]string{"cn09", "cn10"}, "cn[09-10]"},
+		// Different padding can't be in one range.
+		{[]string{"cn1", "cn02"}, "cn[1,02]"},
+		{[]string{"gpu1", "cn2", "cn1", "login"}, "cn[1-2],gpu1,login"},
+	}
+
+	for _, tt := range tests {
+		if got := Compress(tt.in); got != tt.want {
+			t.Errorf("Compress(%v) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func FuzzExpandCompress(f *testing.F) {
+	seeds := []string{
+		"cn1", "cn[1-3]", "cn[01-03,05],login", "cn[9-11]", "cn[098-100]",
+		"rack[1-2]-cn[01-04]", "a1,a01,a001", "0[0-9]", "[1-3]", "cn", "x9,x10,x010",
+	}
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, hostList string) {
+		hosts, err := Expand(hostList)
+		if err != nil || len(hosts) > 10000 {
+			return
+		}
+
+		compressed := Compress(hosts)
+		roundTrip, err := Expand(compressed)
+		if err != nil {
+			t.Fatalf("Expand(Compress(Expand(%q))) = Expand(%q) returned an error: %s",
+				hostList, compressed, err)
+		}
+
+		if want := uniqueSorted(hosts); !reflect.DeepEqual(uniqueSorted(roundTrip), want) ||
+			len(roundTrip) != len(want) {
+			t.Fatalf("Expand(Compress(Expand(%q))) = %v, want %v", hostList, roundTrip, want)
+		}
+		if again := Compress(roundTrip); again != compressed {
+			t.Fatalf("Compress is not stable for %q: %q then %q", hostList, compressed, again)
+		}
+	})
+}
+
+func uniqueSorted(hosts []string) []string {
+	set := make(map[string]bool)
+	for _, host := range hosts {
+		set[host] = true
+	}
+	result := make([]string, 0, len(set))
+	for host := range set {
+		result = append(result, host)
+	}
+	sort.Strings(result)
+	return result
+}
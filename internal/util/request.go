@@ -0,0 +1,277 @@
+/**
+ * Copyright (c) 2023 Peking University and Peking University
+ * Changsha Institute for Computing and Digital Economy
+ *
+ * CraneSched is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of
+ * the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS,
+ * WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+package util
+
+import (
+	"CraneFrontEnd/generated/protos"
+	"CraneFrontEnd/internal/util/hostlist"
+	"fmt"
+	"github.com/spf13/cobra"
+	"strconv"
+)
+
+type resourceOptionKind int
+
+const (
+	stringOption resourceOptionKind = iota
+	uint32Option
+	float64Option
+	// A string option whose value can be empty
+	optionalStringOption
+)
+
+// OptionalValueDefault is the value of an option with an optional value
+// given without one on the command line.
+const OptionalValueDefault = "yes"
+
+// ResourceOption is an option of the job resources shared by the
+// submitting commands. It is accepted on the command line and, by
+// cbatch, in the job script with the same semantics everywhere.
+type ResourceOption struct {
+	Name      string
+	Shorthand string
+	Usage     string
+	// Field is the field of TaskToCtld set by the option, named as in the proto.
+	Field string
+
+	kind resourceOptionKind
+	// set sets the field of the task, or returns why the value is invalid.
+	set func(task *protos.TaskToCtld, val string) error
+}
+
+var ResourceOptions = []*ResourceOption{
+	{"nodes", "N", "number of nodes on which to run", "node_num", uint32Option,
+		func(task *protos.TaskToCtld, val string) error {
+			num, err := parsePositiveUint32(val)
+			task.NodeNum = num
+			return err
+		}},
+	{"cpus-per-task", "c", "number of cpus required per task", "cpus_per_task", float64Option,
+		func(task *protos.TaskToCtld, val string) error {
+			num, err := strconv.ParseFloat(val, 64)
+			if err != nil || num <= 0 {
+				return fmt.Errorf("expect a positive number")
+			}
+			task.CpusPerTask = num
+			return nil
+		}},
+	{"ntasks-per-node", "", "number of tasks to invoke on each node", "ntasks_per_node", uint32Option,
+		func(task *protos.TaskToCtld, val string) error {
+			num, err := parsePositiveUint32(val)
+			task.NtasksPerNode = num
+			return err
+		}},
+	{"time", "t", "time limit, e.g. 1-00:00:00, 90:00 or 30", "time_limit", stringOption,
+		func(task *protos.TaskToCtld, val string) error {
+			return ParseDuration(val, task.TimeLimit)
+		}},
+	{"mem", "", "minimum amount of real memory, e.g. 4G or 512M", "resources.allocatable_resource.memory_limit_bytes", stringOption,
+		func(task *protos.TaskToCtld, val string) error {
+			memInByte, err := ParseMemStringAsByte(val)
+			if err != nil {
+				return err
+			}
+			task.Resources.AllocatableResource.MemoryLimitBytes = memInByte
+			task.Resources.AllocatableResource.MemorySwLimitBytes = memInByte
+			return nil
+		}},
+	{"partition", "p", "partition requested", "partition_name", stringOption,
+		func(task *protos.TaskToCtld, val string) error {
+			task.PartitionName = val
+			return nil
+		}},
+	{"job-name", "J", "name of job", "name", stringOption,
+		func(task *protos.TaskToCtld, val string) error {
+			task.Name = val
+			return nil
+		}},
+	{"account", "A", "account used by the task", "account", stringOption,
+		func(task *protos.TaskToCtld, val string) error {
+			task.Account = val
+			return nil
+		}},
+	{"qos", "q", "quality of service", "qos", stringOption,
+		func(task *protos.TaskToCtld, val string) error {
+			task.Qos = val
+			return nil
+		}},
+	{"chdir", "", "working directory of the task", "cwd", stringOption,
+		func(task *protos.TaskToCtld, val string) error {
+			task.Cwd = val
+			return nil
+		}},
+	{"nodelist", "w", "list of specific nodes to be allocated to the job, e.g. cn[01-04]", "nodelist", stringOption,
+		func(task *protos.TaskToCtld, val string) error {
+			if _, err := hostlist.Expand(val); err != nil {
+				return err
+			}
+			task.Nodelist = val
+			return nil
+		}},
+	{"exclude", "x", "exclude a specific list of hosts, e.g. cn[01-04]", "excludes", stringOption,
+		func(task *protos.TaskToCtld, val string) error {
+			if _, err := hostlist.Expand(val); err != nil {
+				return err
+			}
+			task.Excludes = val
+			return nil
+		}},
+	{"get-user-env", "", "get user's environment variables", "get_user_env", optionalStringOption,
+		func(task *protos.TaskToCtld, val string) error {
+			task.GetUserEnv = true
+			return nil
+		}},
+	{"export", "", "propagate environment variables, e.g. ALL, NONE or ALL,A=a", "env", stringOption,
+		func(task *protos.TaskToCtld, val string) error {
+			// Resolved by SetPropagatedEnviron
+			task.Env["CRANE_EXPORT_ENV"] = val
+			return nil
+		}},
+}
+
+func parsePositiveUint32(val string) (uint32, error) {
+	num, err := strconv.ParseUint(val, 10, 32)
+	if err != nil || num == 0 {
+		return 0, fmt.Errorf("expect a positive integer")
+	}
+	return uint32(num), nil
+}
+
+// LookupResourceOption returns the resource option of the name, which is
+// either "--" followed by the long name or "-" followed by the shorthand.
+// nil is returned if there is no such option.
+func LookupResourceOption(name string) *ResourceOption {
+	for _, opt := range ResourceOptions {
+		if name == "--"+opt.Name || (opt.Shorthand != "" && name == "-"+opt.Shorthand) {
+			return opt
+		}
+	}
+	return nil
+}
+
+// Check returns why the value is invalid for the option, or nil.
+func (opt *ResourceOption) Check(val string) error {
+	if val == "" && opt.kind != optionalStringOption {
+		return fmt.Errorf("expect a value")
+	}
+	return opt.set(NewTaskToCtld(), val)
+}
+
+// Set sets the field of the task given by the option.
+func (opt *ResourceOption) Set(task *protos.TaskToCtld, val string) error {
+	err := opt.Check(val)
+	if err == nil {
+		err = opt.set(task, val)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid --%s %q: %s", opt.Name, val, err)
+	}
+	return nil
+}
+
+// NewTaskToCtld returns a task with the default resources, which are
+// one task with one cpu on one node, no time limit and no memory limit.
+// The partition and the account are chosen by CraneCtld if not given.
+func NewTaskToCtld() *protos.TaskToCtld {
+	return &protos.TaskToCtld{
+		TimeLimit: InvalidDuration(),
+		Resources: &protos.Resources{
+			AllocatableResource: &protos.AllocatableResource{
+				CpuCoreLimit:       1,
+				MemoryLimitBytes:   0,
+				MemorySwLimitBytes: 0,
+			},
+		},
+		CpusPerTask:   1,
+		NtasksPerNode: 1,
+		NodeNum:       1,
+		GetUserEnv:    false,
+		Env:           make(map[string]string),
+	}
+}
+
+// ResourceFlags are the resource options on the command line of a
+// submitting command.
+type ResourceFlags struct {
+	cmd *cobra.Command
+	// Long names of the options added to the command
+	names []string
+}
+
+// AddFlags adds the resource options of the long names to the flags of
+// the command, or all of them if no name is given.
+func (f *ResourceFlags) AddFlags(cmd *cobra.Command, names ...string) {
+	f.cmd = cmd
+	for _, opt := range ResourceOptions {
+		if len(names) > 0 && !containsName(names, opt.Name) {
+			continue
+		}
+		f.names = append(f.names, opt.Name)
+		switch opt.kind {
+		case uint32Option:
+			cmd.Flags().Uint32P(opt.Name, opt.Shorthand, 0, opt.Usage)
+		case float64Option:
+			cmd.Flags().Float64P(opt.Name, opt.Shorthand, 0, opt.Usage)
+		case optionalStringOption:
+			cmd.Flags().StringP(opt.Name, opt.Shorthand, "", opt.Usage)
+			// The value can only be given with "=", so that a bare flag
+			// doesn't take the next argument, e.g. the job script.
+			cmd.Flags().Lookup(opt.Name).NoOptDefVal = OptionalValueDefault
+		default:
+			cmd.Flags().StringP(opt.Name, opt.Shorthand, "", opt.Usage)
+		}
+	}
+}
+
+func containsName(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Changed returns whether the option of the long name is given on the
+// command line or by the defaults.
+func (f *ResourceFlags) Changed(name string) bool {
+	return f.cmd != nil && f.cmd.Flags().Changed(name)
+}
+
+// Apply sets the fields of the task given on the command line, which
+// override the ones set before, e.g. by the directives of cbatch.
+// Options not added to the command are skipped.
+func (f *ResourceFlags) Apply(task *protos.TaskToCtld) error {
+	for _, opt := range ResourceOptions {
+		if !f.Changed(opt.Name) {
+			continue
+		}
+		if err := opt.Set(task, f.cmd.Flags().Lookup(opt.Name).Value.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckResources validates the resources of the task as a whole and sets
+// the ones derived from the others.
+func CheckResources(task *protos.TaskToCtld) error {
+	if task.CpusPerTask <= 0 || task.NtasksPerNode == 0 || task.NodeNum == 0 {
+		return fmt.Errorf("invalid --cpus-per-task, --ntasks-per-node or --nodes")
+	}
+	task.Resources.AllocatableResource.CpuCoreLimit = task.CpusPerTask * float64(task.NtasksPerNode)
+	return nil
+}
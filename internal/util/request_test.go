@@ -0,0 +1,50 @@
+/**
+ * Copyright (c) 2023 Peking University and Peking University
+ * Changsha Institute for Computing and Digital Economy
+ *
+ * CraneSched is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of
+ * the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS,
+ * WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+package util
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestResourceFlagsOptionalValue(t *testing.T) {
+	tests := []struct {
+		args           []string
+		wantGetUserEnv bool
+		wantPositional []string
+	}{
+		{[]string{"--get-user-env", "job.sh"}, true, []string{"job.sh"}},
+		{[]string{"--get-user-env=10L", "job.sh"}, true, []string{"job.sh"}},
+		{[]string{"job.sh", "--get-user-env"}, true, []string{"job.sh"}},
+		{[]string{"job.sh"}, false, []string{"job.sh"}},
+	}
+
+	for _, tt := range tests {
+		cmd, flags := newResourceCommand(t, tt.args...)
+		if got := cmd.Flags().Args(); !reflect.DeepEqual(got, tt.wantPositional) {
+			t.Errorf("%v: positional args = %v, want %v", tt.args, got, tt.wantPositional)
+		}
+
+		task := NewTaskToCtld()
+		if err := flags.Apply(task); err != nil {
+			t.Errorf("%v: Apply: %s", tt.args, err)
+			continue
+		}
+		if task.GetUserEnv != tt.wantGetUserEnv {
+			t.Errorf("%v: GetUserEnv = %v, want %v", tt.args, task.GetUserEnv, tt.wantGetUserEnv)
+		}
+	}
+}
@@ -18,56 +18,10 @@ package util
 
 import (
 	"fmt"
-	"github.com/golang/protobuf/ptypes/duration"
-	"regexp"
-	"strconv"
+	"strings"
 	"time"
 )
 
-func ParseMemStringAsByte(mem string) (uint64, error) {
-	re := regexp.MustCompile(`([0-9]+(\.?[0-9]+)?)([MmGgKk])`)
-	result := re.FindAllStringSubmatch(mem, -1)
-	if result == nil || len(result) != 1 {
-		return 0, fmt.Errorf("invalid memory format")
-	}
-	sz, err := strconv.ParseFloat(result[0][1], 10)
-	if err != nil {
-		return 0, err
-	}
-	switch result[0][len(result[0])-1] {
-	case "M", "m":
-		return uint64(1024 * 1024 * sz), nil
-	case "G", "g":
-		return uint64(1024 * 1024 * 1024 * sz), nil
-	case "K", "k":
-		return uint64(1024 * sz), nil
-	}
-	return uint64(sz), nil
-}
-
-func ParseDuration(time string, duration *duration.Duration) bool {
-	re := regexp.MustCompile(`(.*):(.*):(.*)`)
-	result := re.FindAllStringSubmatch(time, -1)
-	if result == nil || len(result) != 1 {
-		return false
-	}
-	hh, err := strconv.ParseUint(result[0][1], 10, 32)
-	if err != nil {
-		return false
-	}
-	mm, err := strconv.ParseUint(result[0][2], 10, 32)
-	if err != nil {
-		return false
-	}
-	ss, err := strconv.ParseUint(result[0][3], 10, 32)
-	if err != nil {
-		return false
-	}
-
-	duration.Seconds = int64(60*60*hh + 60*mm + ss)
-	return true
-}
-
 func ParseTime(ts string) (time.Time, error) {
 	// Try to parse the timezone at first
 	layout := time.RFC3339
@@ -97,3 +51,87 @@ func SecondTimeFormat(second int64) string {
 	}
 	return timeFormat
 }
+
+// ShellWord is a word of a command line after the shell-style quoting
+// is removed. Offset is the index of the byte where the word begins.
+type ShellWord struct {
+	Text   string
+	Offset int
+}
+
+// ShellSyntaxError reports where a command line is malformed.
+// Offset is the index of the offending byte.
+type ShellSyntaxError struct {
+	Offset int
+	Msg    string
+}
+
+func (e *ShellSyntaxError) Error() string {
+	return e.Msg
+}
+
+// SplitShellWords splits the line into words like a POSIX shell does,
+// handling single quotes, double quotes, backslash escapes and comments.
+func SplitShellWords(line string) ([]ShellWord, error) {
+	var words []ShellWord
+	var builder strings.Builder
+	inWord := false
+	wordOffset := 0
+
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == ' ' || c == '\t':
+			if inWord {
+				words = append(words, ShellWord{builder.String(), wordOffset})
+				builder.Reset()
+				inWord = false
+			}
+			continue
+		case c == '#' && !inWord:
+			// Trailing comment
+			return words, nil
+		}
+
+		if !inWord {
+			inWord = true
+			wordOffset = i
+		}
+
+		switch c {
+		case '\'':
+			end := strings.IndexByte(line[i+1:], '\'')
+			if end == -1 {
+				return nil, &ShellSyntaxError{i, "unterminated single quote"}
+			}
+			builder.WriteString(line[i+1 : i+1+end])
+			i += end + 1
+		case '"':
+			j := i + 1
+			for ; j < len(line) && line[j] != '"'; j++ {
+				// Only these characters can be escaped in double quotes.
+				if line[j] == '\\' && j+1 < len(line) && strings.IndexByte("\"\\$`", line[j+1]) != -1 {
+					j++
+				}
+				builder.WriteByte(line[j])
+			}
+			if j == len(line) {
+				return nil, &ShellSyntaxError{i, "unterminated double quote"}
+			}
+			i = j
+		case '\\':
+			if i+1 == len(line) {
+				return nil, &ShellSyntaxError{i, "dangling backslash"}
+			}
+			i++
+			builder.WriteByte(line[i])
+		default:
+			builder.WriteByte(c)
+		}
+	}
+
+	if inWord {
+		words = append(words, ShellWord{builder.String(), wordOffset})
+	}
+	return words, nil
+}
@@ -0,0 +1,72 @@
+/**
+ * Copyright (c) 2023 Peking University and Peking University
+ * Changsha Institute for Computing and Digital Economy
+ *
+ * CraneSched is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of
+ * the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS,
+ * WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+package util
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitShellWords(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []ShellWord
+	}{
+		{"", nil},
+		{"   ", nil},
+		{"a b\tc", []ShellWord{{"a", 0}, {"b", 2}, {"c", 4}}},
+		{"  -N 2", []ShellWord{{"-N", 2}, {"2", 5}}},
+		{`--job-name="my job"`, []ShellWord{{"--job-name=my job", 0}}},
+		{`'a "b"' c`, []ShellWord{{`a "b"`, 0}, {"c", 8}}},
+		{`"a \"b\" \$c \d"`, []ShellWord{{`a "b" $c \d`, 0}}},
+		{`a\ b`, []ShellWord{{"a b", 0}}},
+		{`a''b`, []ShellWord{{"ab", 0}}},
+		{"a # comment", []ShellWord{{"a", 0}}},
+		{"a#b", []ShellWord{{"a#b", 0}}},
+		{"# comment", nil},
+	}
+
+	for _, tt := range tests {
+		got, err := SplitShellWords(tt.in)
+		if err != nil {
+			t.Errorf("SplitShellWords(%q) returned an error: %s", tt.in, err)
+		} else if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SplitShellWords(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSplitShellWordsInvalid(t *testing.T) {
+	tests := []struct {
+		in         string
+		wantOffset int
+	}{
+		{"a 'b", 2},
+		{`a "b`, 2},
+		{`"a \"`, 0},
+		{`a\`, 1},
+	}
+
+	for _, tt := range tests {
+		_, err := SplitShellWords(tt.in)
+		syntaxErr, ok := err.(*ShellSyntaxError)
+		if !ok {
+			t.Errorf("SplitShellWords(%q) returned %v, want a *ShellSyntaxError", tt.in, err)
+		} else if syntaxErr.Offset != tt.wantOffset {
+			t.Errorf("SplitShellWords(%q) failed at %d, want %d", tt.in, syntaxErr.Offset, tt.wantOffset)
+		}
+	}
+}
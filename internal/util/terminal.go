@@ -17,10 +17,18 @@
 package util
 
 import (
+	"github.com/pkg/term/termios"
+	log "github.com/sirupsen/logrus"
 	"golang.org/x/sys/unix"
 	"os"
 	"os/exec"
 	"strings"
+	"sync"
+)
+
+var (
+	savedTermAttr    *unix.Termios
+	savedTermAttrMtx sync.Mutex
 )
 
 func NixShell(uid string) (string, error) {
@@ -67,3 +75,55 @@ func IsForeground() bool {
 	pgrp2 := unix.Getpgrp()
 	return pgrp1 == pgrp2
 }
+
+// SaveTerminal saves the attributes of the terminal of stdin to be
+// restored by RestoreTerminal however the process exits. An error is
+// returned if stdin is not a terminal.
+func SaveTerminal() error {
+	savedTermAttrMtx.Lock()
+	defer savedTermAttrMtx.Unlock()
+
+	attr := new(unix.Termios)
+	if err := termios.Tcgetattr(os.Stdin.Fd(), attr); err != nil {
+		return err
+	}
+
+	if savedTermAttr == nil {
+		// log.Fatal doesn't run the deferred functions.
+		log.RegisterExitHandler(RestoreTerminal)
+	}
+	savedTermAttr = attr
+
+	return nil
+}
+
+// SetTerminalRaw saves the attributes of the terminal of stdin and puts it
+// into raw mode, so that every key stroke, including ^C and ^Z, is read
+// as is.
+func SetTerminalRaw() error {
+	if err := SaveTerminal(); err != nil {
+		return err
+	}
+
+	savedTermAttrMtx.Lock()
+	defer savedTermAttrMtx.Unlock()
+
+	rawAttr := *savedTermAttr
+	termios.Cfmakeraw(&rawAttr)
+	return termios.Tcsetattr(os.Stdin.Fd(), termios.TCSANOW, &rawAttr)
+}
+
+// RestoreTerminal restores the terminal attributes saved by SaveTerminal
+// or SetTerminalRaw. It is safe to call it multiple times or without
+// saving the attributes first.
+func RestoreTerminal() {
+	savedTermAttrMtx.Lock()
+	defer savedTermAttrMtx.Unlock()
+
+	if savedTermAttr == nil {
+		return
+	}
+	if err := termios.Tcsetattr(os.Stdin.Fd(), termios.TCSANOW, savedTermAttr); err != nil {
+		log.Debugf("tcsetattr: %v", err)
+	}
+}
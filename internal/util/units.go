@@ -0,0 +1,141 @@
+/**
+ * Copyright (c) 2023 Peking University and Peking University
+ * Changsha Institute for Computing and Digital Economy
+ *
+ * CraneSched is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of
+ * the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS,
+ * WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package util
+
+import (
+	"fmt"
+	"github.com/golang/protobuf/ptypes/duration"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const durationFormats = "MM, MM:SS, HH:MM:SS, D-HH, D-HH:MM, D-HH:MM:SS or unlimited"
+
+// ParseDurationSeconds parses a time limit in any of the forms accepted
+// by Slurm: "MM", "MM:SS", "HH:MM:SS", "D-HH", "D-HH:MM", "D-HH:MM:SS"
+// and "unlimited". The unlimited time is InvalidDuration().
+func ParseDurationSeconds(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	switch strings.ToLower(s) {
+	case "unlimited", "infinite":
+		return InvalidDuration().Seconds, nil
+	}
+
+	var days uint64
+	dayStr, rest, hasDay := strings.Cut(s, "-")
+	if hasDay {
+		d, err := strconv.ParseUint(dayStr, 10, 32)
+		if err != nil {
+			return 0, fmt.Errorf("invalid time %q: expect %s", s, durationFormats)
+		}
+		days = d
+	} else {
+		rest = dayStr
+	}
+
+	fields := strings.Split(rest, ":")
+	if len(fields) > 3 {
+		return 0, fmt.Errorf("invalid time %q: expect %s", s, durationFormats)
+	}
+	nums := make([]uint64, len(fields))
+	for i, field := range fields {
+		n, err := strconv.ParseUint(field, 10, 32)
+		if err != nil {
+			return 0, fmt.Errorf("invalid time %q: expect %s", s, durationFormats)
+		}
+		nums[i] = n
+	}
+
+	var hh, mm, ss uint64
+	switch {
+	case len(nums) == 3:
+		hh, mm, ss = nums[0], nums[1], nums[2]
+	case hasDay && len(nums) == 2:
+		hh, mm = nums[0], nums[1]
+	case hasDay:
+		hh = nums[0]
+	case len(nums) == 2:
+		mm, ss = nums[0], nums[1]
+	default:
+		mm = nums[0]
+	}
+
+	seconds := days*24*3600 + hh*3600 + mm*60 + ss
+	if seconds >= uint64(InvalidDuration().Seconds) {
+		return 0, fmt.Errorf("time %q is too long", s)
+	}
+	return int64(seconds), nil
+}
+
+// ParseDuration parses the time limit into duration. See ParseDurationSeconds.
+func ParseDuration(s string, duration *duration.Duration) error {
+	seconds, err := ParseDurationSeconds(s)
+	if err != nil {
+		return err
+	}
+	duration.Seconds = seconds
+	duration.Nanos = 0
+	return nil
+}
+
+var memPattern = regexp.MustCompile(`(?i)^([0-9]+(\.[0-9]+)?)\s*([KMGT]?)(I?B)?$`)
+
+// ParseMemStringAsByte parses a memory size like "512M", "4GiB", "1.5T"
+// or "1024B". The units are binary, i.e. 1K is 1024 bytes. As in Slurm,
+// a size without unit is in megabytes.
+func ParseMemStringAsByte(mem string) (uint64, error) {
+	result := memPattern.FindStringSubmatch(strings.TrimSpace(mem))
+	if result == nil {
+		return 0, fmt.Errorf("invalid memory size %q: expect a number with an optional unit "+
+			"K, M, G or T, e.g. 512M or 4GiB", mem)
+	}
+	sz, err := strconv.ParseFloat(result[1], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid memory size %q: %s", mem, err)
+	}
+
+	unit := strings.ToUpper(result[3])
+	suffix := strings.ToUpper(result[4])
+	if unit == "" && suffix == "IB" {
+		return 0, fmt.Errorf("invalid memory size %q: iB must follow K, M, G or T", mem)
+	}
+
+	var shift uint
+	switch unit {
+	case "K":
+		shift = 10
+	case "M":
+		shift = 20
+	case "G":
+		shift = 30
+	case "T":
+		shift = 40
+	default:
+		if suffix == "" {
+			// Megabytes by default
+			shift = 20
+		}
+	}
+
+	bytes := sz * float64(uint64(1)<<shift)
+	if bytes >= math.MaxUint64 {
+		return 0, fmt.Errorf("memory size %q is too large", mem)
+	}
+	return uint64(bytes), nil
+}
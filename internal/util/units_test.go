@@ -0,0 +1,158 @@
+/**
+ * Copyright (c) 2023 Peking University and Peking University
+ * Changsha Institute for Computing and Digital Economy
+ *
+ * CraneSched is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of
+ * the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS,
+ * WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package util
+
+import (
+	"github.com/golang/protobuf/ptypes/duration"
+	"testing"
+)
+
+func TestParseDurationSeconds(t *testing.T) {
+	unlimited := InvalidDuration().Seconds
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		// A bare number is in minutes.
+		{"0", 0, false},
+		{"30", 30 * 60, false},
+		{"90", 90 * 60, false},
+		{" 5 ", 5 * 60, false},
+		// MM:SS
+		{"90:00", 90 * 60, false},
+		{"1:30", 90, false},
+		// HH:MM:SS
+		{"01:00:00", 3600, false},
+		{"2:03:04", 2*3600 + 3*60 + 4, false},
+		// D-HH, D-HH:MM and D-HH:MM:SS
+		{"1-0", 24 * 3600, false},
+		{"2-12", 2*24*3600 + 12*3600, false},
+		{"1-02:30", 24*3600 + 2*3600 + 30*60, false},
+		{"1-00:00:01", 24*3600 + 1, false},
+		// Unlimited
+		{"unlimited", unlimited, false},
+		{"UNLIMITED", unlimited, false},
+		{"infinite", unlimited, false},
+		// Invalid input
+		{"", 0, true},
+		{"abc", 0, true},
+		{"-5", 0, true},
+		{"1.5", 0, true},
+		{"1h", 0, true},
+		{"1:2:3:4", 0, true},
+		{"1-2:3:4:5", 0, true},
+		{"x-01:00:00", 0, true},
+		{"01::00", 0, true},
+		{"1-", 0, true},
+		{"4000000-00:00:00", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseDurationSeconds(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseDurationSeconds(%q) = %d, want an error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseDurationSeconds(%q) returned an error: %s", tt.in, err)
+		} else if got != tt.want {
+			t.Errorf("ParseDurationSeconds(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{"10", 600, false},
+		{"1-00:00:00", 24 * 3600, false},
+		{"unlimited", InvalidDuration().Seconds, false},
+		{"1:2:3:4", 0, true},
+	}
+
+	for _, tt := range tests {
+		d := &duration.Duration{Seconds: -1, Nanos: 1}
+		err := ParseDuration(tt.in, d)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseDuration(%q) = %ds, want an error", tt.in, d.Seconds)
+			} else if d.Seconds != -1 {
+				t.Errorf("ParseDuration(%q) modified the duration on error", tt.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseDuration(%q) returned an error: %s", tt.in, err)
+		} else if d.Seconds != tt.want || d.Nanos != 0 {
+			t.Errorf("ParseDuration(%q) = %ds %dns, want %ds", tt.in, d.Seconds, d.Nanos, tt.want)
+		}
+	}
+}
+
+func TestParseMemStringAsByte(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    uint64
+		wantErr bool
+	}{
+		// A bare number is in megabytes.
+		{"512", 512 << 20, false},
+		{"0", 0, false},
+		// Suffixes
+		{"1024B", 1024, false},
+		{"4K", 4 << 10, false},
+		{"4k", 4 << 10, false},
+		{"512M", 512 << 20, false},
+		{"4G", 4 << 30, false},
+		{"4GB", 4 << 30, false},
+		{"4GiB", 4 << 30, false},
+		{"4gib", 4 << 30, false},
+		{"2T", 2 << 40, false},
+		{"1.5G", 3 << 29, false},
+		{"4 G", 4 << 30, false},
+		// Invalid input
+		{"", 0, true},
+		{"G", 0, true},
+		{"4X", 0, true},
+		{"-1G", 0, true},
+		{"4iB", 0, true},
+		{"4GiBs", 0, true},
+		{"1.G", 0, true},
+		{"99999999999T", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseMemStringAsByte(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseMemStringAsByte(%q) = %d, want an error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseMemStringAsByte(%q) returned an error: %s", tt.in, err)
+		} else if got != tt.want {
+			t.Errorf("ParseMemStringAsByte(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
@@ -31,20 +31,45 @@ import (
 type Config struct {
 	ControlMachine      string `yaml:"ControlMachine"`
 	CraneCtldListenPort string `yaml:"CraneCtldListenPort"`
+	CranedListenPort    string `yaml:"CranedListenPort"`
 
 	UseTls             bool   `yaml:"UseTls"`
 	ServerCertFilePath string `yaml:"ServerCertFilePath"`
 	ServerKeyFilePath  string `yaml:"ServerKeyFilePath"`
 	CaCertFilePath     string `yaml:"CaCertFilePath"`
 	DomainSuffix       string `yaml:"DomainSuffix"`
+
+	// Whether cbatch translates #SBATCH and #PBS directives by default
+	TranslateForeignDirectives bool `yaml:"TranslateForeignDirectives"`
+
+	// Filters run by cbatch and calloc in order before the job is submitted
+	SubmitFilters []SubmitFilterConfig `yaml:"SubmitFilters"`
+
+	// Retention of the submissions recorded by cbatch
+	SubmissionJournal JournalConfig `yaml:"SubmissionJournal"`
 }
 
+// JournalConfig is how many submissions cbatch keeps in the journal
+// of each user. A zero value means the default.
+type JournalConfig struct {
+	Disabled   bool `yaml:"Disabled"`
+	MaxEntries int  `yaml:"MaxEntries"`
+	MaxAgeDays int  `yaml:"MaxAgeDays"`
+}
+
+const (
+	// CraneExitCodeBase is added to the signal number in the exit code
+	// of a task which is terminated by a signal.
+	CraneExitCodeBase = 256
+)
+
 var (
 	DefaultConfigPath                string
 	DefaultCforedRuntimeDir          string
 	DefaultCforedUnixSocketPath      string
 	DefaultCforedServerListenAddress string
 	DefaultCforedServerListenPort    string
+	DefaultCranedListenPort          string
 )
 
 func init() {
@@ -53,6 +78,7 @@ func init() {
 	DefaultCforedUnixSocketPath = DefaultCforedRuntimeDir + "/cfored.sock"
 	DefaultCforedServerListenAddress = "0.0.0.0"
 	DefaultCforedServerListenPort = "10012"
+	DefaultCranedListenPort = "10010"
 }
 
 func SetBorderlessTable(table *tablewriter.Table) {